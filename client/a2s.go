@@ -0,0 +1,262 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/comoyi/valheim-launcher/log"
+	"math"
+	"net"
+	"time"
+)
+
+// Steam A2S 查询协议 https://developer.valvesoftware.com/wiki/Server_queries
+
+const (
+	a2sHeaderSimple int32 = -1
+	a2sHeaderSplit  int32 = -2
+
+	a2sInfoRequest       byte = 0x54
+	a2sInfoResponse      byte = 0x49
+	a2sPlayerRequest     byte = 0x55
+	a2sPlayerResponse    byte = 0x44
+	a2sChallengeResponse byte = 0x41
+
+	a2sMaxPacketSize = 1400
+)
+
+var errA2SSplitPacket = fmt.Errorf("a2s split packet response not supported")
+
+type ServerStatus struct {
+	Name       string
+	Map        string
+	Folder     string
+	Game       string
+	Version    string
+	Players    int
+	MaxPlayers int
+	Bots       int
+	PlayerList []*ServerPlayer
+	Ping       time.Duration
+}
+
+type ServerPlayer struct {
+	Name     string
+	Score    int32
+	Duration time.Duration
+}
+
+func queryServerStatus(address string, timeout time.Duration) (*ServerStatus, error) {
+	conn, err := net.DialTimeout("udp", address, timeout)
+	if err != nil {
+		log.Debugf("dial game server failed, address: %s, err: %v\n", address, err)
+		return nil, err
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	serverStatus, err := queryA2SInfo(conn)
+	if err != nil {
+		log.Debugf("query a2s info failed, address: %s, err: %v\n", address, err)
+		return nil, err
+	}
+
+	players, err := queryA2SPlayer(conn)
+	if err != nil {
+		// 部分服务器不响应玩家列表，不影响基本信息的显示
+		log.Debugf("query a2s player failed, address: %s, err: %v\n", address, err)
+	} else {
+		serverStatus.PlayerList = players
+	}
+	return serverStatus, nil
+}
+
+func queryA2SInfo(conn net.Conn) (*ServerStatus, error) {
+	payload := append([]byte("Source Engine Query"), 0)
+
+	startTime := time.Now()
+	resp, err := a2sRequest(conn, a2sInfoRequest, payload)
+	if err != nil {
+		return nil, err
+	}
+	ping := time.Since(startTime)
+
+	if resp[0] == a2sChallengeResponse {
+		if len(resp) < 5 {
+			return nil, fmt.Errorf("invalid a2s challenge response")
+		}
+		payload = append(payload, resp[1:5]...)
+		startTime = time.Now()
+		resp, err = a2sRequest(conn, a2sInfoRequest, payload)
+		if err != nil {
+			return nil, err
+		}
+		ping = time.Since(startTime)
+	}
+	if resp[0] != a2sInfoResponse {
+		return nil, fmt.Errorf("unexpected a2s info response type: 0x%x", resp[0])
+	}
+
+	serverStatus, err := parseA2SInfo(resp[1:])
+	if err != nil {
+		return nil, err
+	}
+	serverStatus.Ping = ping
+	return serverStatus, nil
+}
+
+func queryA2SPlayer(conn net.Conn) ([]*ServerPlayer, error) {
+	challenge := []byte{0xFF, 0xFF, 0xFF, 0xFF}
+	resp, err := a2sRequest(conn, a2sPlayerRequest, challenge)
+	if err != nil {
+		return nil, err
+	}
+	if resp[0] == a2sChallengeResponse {
+		if len(resp) < 5 {
+			return nil, fmt.Errorf("invalid a2s challenge response")
+		}
+		resp, err = a2sRequest(conn, a2sPlayerRequest, resp[1:5])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if resp[0] != a2sPlayerResponse {
+		return nil, fmt.Errorf("unexpected a2s player response type: 0x%x", resp[0])
+	}
+	return parseA2SPlayer(resp[1:])
+}
+
+// a2sRequest 发送请求并返回去掉包头的响应，响应至少包含1个字节的类型
+func a2sRequest(conn net.Conn, requestType byte, payload []byte) ([]byte, error) {
+	req := bytes.NewBuffer(make([]byte, 0, 5+len(payload)))
+	_ = binary.Write(req, binary.LittleEndian, a2sHeaderSimple)
+	req.WriteByte(requestType)
+	req.Write(payload)
+	_, err := conn.Write(req.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, a2sMaxPacketSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	if n < 5 {
+		return nil, fmt.Errorf("a2s response too short, length: %d", n)
+	}
+	header := int32(binary.LittleEndian.Uint32(buf[:4]))
+	if header == a2sHeaderSplit {
+		return nil, errA2SSplitPacket
+	}
+	if header != a2sHeaderSimple {
+		return nil, fmt.Errorf("invalid a2s response header: %d", header)
+	}
+	return buf[4:n], nil
+}
+
+func parseA2SInfo(data []byte) (*ServerStatus, error) {
+	r := &a2sReader{data: data}
+	serverStatus := &ServerStatus{}
+
+	r.readByte() // protocol
+	serverStatus.Name = r.readString()
+	serverStatus.Map = r.readString()
+	serverStatus.Folder = r.readString()
+	serverStatus.Game = r.readString()
+	r.readUint16() // app id
+	serverStatus.Players = int(r.readByte())
+	serverStatus.MaxPlayers = int(r.readByte())
+	serverStatus.Bots = int(r.readByte())
+	r.readByte() // server type
+	r.readByte() // environment
+	r.readByte() // visibility
+	r.readByte() // vac
+	serverStatus.Version = r.readString()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return serverStatus, nil
+}
+
+func parseA2SPlayer(data []byte) ([]*ServerPlayer, error) {
+	r := &a2sReader{data: data}
+	count := int(r.readByte())
+	players := make([]*ServerPlayer, 0, count)
+	for i := 0; i < count; i++ {
+		r.readByte() // index
+		name := r.readString()
+		score := int32(r.readUint32())
+		duration := math.Float32frombits(r.readUint32())
+		if r.err != nil {
+			return nil, r.err
+		}
+		players = append(players, &ServerPlayer{
+			Name:     name,
+			Score:    score,
+			Duration: time.Duration(float64(duration) * float64(time.Second)),
+		})
+	}
+	return players, nil
+}
+
+type a2sReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *a2sReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if r.pos+n > len(r.data) {
+		r.err = fmt.Errorf("a2s response truncated at offset %d", r.pos)
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *a2sReader) readByte() byte {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *a2sReader) readUint16() uint16 {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (r *a2sReader) readUint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *a2sReader) readString() string {
+	if r.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(r.data[r.pos:], 0)
+	if end < 0 {
+		r.err = fmt.Errorf("a2s response string not terminated at offset %d", r.pos)
+		return ""
+	}
+	s := string(r.data[r.pos : r.pos+end])
+	r.pos += end + 1
+	return s
+}
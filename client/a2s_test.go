@@ -0,0 +1,181 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/spf13/viper"
+)
+
+func TestMain(m *testing.M) {
+	// 测试时不写日志文件
+	viper.Set("log_level", log.Off)
+	os.Exit(m.Run())
+}
+
+var testChallenge = []byte{0x11, 0x22, 0x33, 0x44}
+
+// fakeA2SServer 本地UDP响应端，handler返回nil时不响应
+func fakeA2SServer(t *testing.T, handler func(req []byte) []byte) string {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	go func() {
+		buf := make([]byte, a2sMaxPacketSize)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			resp := handler(append([]byte(nil), buf[:n]...))
+			if resp != nil {
+				_, _ = conn.WriteToUDP(resp, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func a2sPacket(responseType byte, body []byte) []byte {
+	b := &bytes.Buffer{}
+	_ = binary.Write(b, binary.LittleEndian, a2sHeaderSimple)
+	b.WriteByte(responseType)
+	b.Write(body)
+	return b.Bytes()
+}
+
+func a2sString(b *bytes.Buffer, s string) {
+	b.WriteString(s)
+	b.WriteByte(0)
+}
+
+func testA2SInfoBody() []byte {
+	b := &bytes.Buffer{}
+	b.WriteByte(17)
+	a2sString(b, "Test Server")
+	a2sString(b, "World")
+	a2sString(b, "valheim")
+	a2sString(b, "Valheim")
+	_ = binary.Write(b, binary.LittleEndian, uint16(0)) // app id 超过uint16时为0
+	b.WriteByte(2)
+	b.WriteByte(10)
+	b.WriteByte(0)
+	b.WriteByte('d')
+	b.WriteByte('w')
+	b.WriteByte(0)
+	b.WriteByte(0)
+	a2sString(b, "0.217.22")
+	return b.Bytes()
+}
+
+func testA2SPlayerBody() []byte {
+	b := &bytes.Buffer{}
+	b.WriteByte(2)
+	for i, name := range []string{"Alice", "Bob"} {
+		b.WriteByte(byte(i))
+		a2sString(b, name)
+		_ = binary.Write(b, binary.LittleEndian, int32(i*10))
+		_ = binary.Write(b, binary.LittleEndian, math.Float32bits(float32(60*(i+1))))
+	}
+	return b.Bytes()
+}
+
+// challengeHandler 请求没有带上challenge时返回S2C_CHALLENGE
+func challengeHandler(t *testing.T, infoBody []byte, playerBody []byte) func(req []byte) []byte {
+	return func(req []byte) []byte {
+		if len(req) < 5 {
+			t.Errorf("request too short: %v", req)
+			return nil
+		}
+		payload := req[5:]
+		switch req[4] {
+		case a2sInfoRequest:
+			query := append([]byte("Source Engine Query"), 0)
+			if !bytes.HasPrefix(payload, query) {
+				t.Errorf("unexpected a2s info payload: %v", payload)
+				return nil
+			}
+			if !bytes.Equal(payload[len(query):], testChallenge) {
+				return a2sPacket(a2sChallengeResponse, testChallenge)
+			}
+			return a2sPacket(a2sInfoResponse, infoBody)
+		case a2sPlayerRequest:
+			if !bytes.Equal(payload, testChallenge) {
+				return a2sPacket(a2sChallengeResponse, testChallenge)
+			}
+			return a2sPacket(a2sPlayerResponse, playerBody)
+		}
+		t.Errorf("unexpected request type: 0x%x", req[4])
+		return nil
+	}
+}
+
+func TestQueryServerStatusChallenge(t *testing.T) {
+	address := fakeA2SServer(t, challengeHandler(t, testA2SInfoBody(), testA2SPlayerBody()))
+
+	serverStatus, err := queryServerStatus(address, 2*time.Second)
+	if err != nil {
+		t.Fatalf("query server status failed, err: %v", err)
+	}
+	if serverStatus.Name != "Test Server" || serverStatus.Map != "World" || serverStatus.Version != "0.217.22" {
+		t.Errorf("unexpected server status: %+v", serverStatus)
+	}
+	if serverStatus.Players != 2 || serverStatus.MaxPlayers != 10 {
+		t.Errorf("unexpected player count: %d/%d", serverStatus.Players, serverStatus.MaxPlayers)
+	}
+	if len(serverStatus.PlayerList) != 2 {
+		t.Fatalf("unexpected player list length: %d", len(serverStatus.PlayerList))
+	}
+	player := serverStatus.PlayerList[1]
+	if player.Name != "Bob" || player.Score != 10 || player.Duration != 120*time.Second {
+		t.Errorf("unexpected player: %+v", player)
+	}
+}
+
+func TestQueryServerStatusTruncated(t *testing.T) {
+	infoBody := testA2SInfoBody()
+	address := fakeA2SServer(t, challengeHandler(t, infoBody[:10], testA2SPlayerBody()))
+
+	_, err := queryServerStatus(address, 2*time.Second)
+	if err == nil {
+		t.Fatal("expected error for truncated a2s info response")
+	}
+}
+
+func TestParseA2SPlayerTruncated(t *testing.T) {
+	playerBody := testA2SPlayerBody()
+	_, err := parseA2SPlayer(playerBody[:len(playerBody)-2])
+	if err == nil {
+		t.Fatal("expected error for truncated a2s player response")
+	}
+}
+
+func TestQueryServerStatusTimeout(t *testing.T) {
+	address := fakeA2SServer(t, func(req []byte) []byte {
+		return nil
+	})
+
+	startTime := time.Now()
+	_, err := queryServerStatus(address, 200*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("expected timeout error, got: %v", err)
+	}
+	if time.Since(startTime) > 2*time.Second {
+		t.Errorf("query did not respect timeout, elapsed: %v", time.Since(startTime))
+	}
+}
@@ -4,9 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/widget"
 	"github.com/comoyi/valheim-launcher/log"
+	"github.com/comoyi/valheim-launcher/util/cryptoutil/md5util"
+	"github.com/comoyi/valheim-launcher/util/timeutil"
+	"io"
+	"net/http"
 	"net/url"
+	"path/filepath"
+	"sort"
+	"time"
 )
 
 var ann = &Announcement{
@@ -14,43 +22,251 @@ var ann = &Announcement{
 	Hash:    "",
 }
 
-func refreshAnnouncement(w *widget.Label, box *fyne.Container, c *fyne.Container) {
+// annTime 当前公告从服务器获取的时间
+var annTime int64
+
+// AnnouncementCache 最近一次获取到的公告，无法连接服务器时显示
+type AnnouncementCache struct {
+	Announcement *Announcement `json:"announcement"`
+	Time         int64         `json:"time"`
+}
+
+func refreshAnnouncement(title *widget.Label, list *fyne.Container, box *fyne.Container, c *fyne.Container) {
 	announcement, err := getAnnouncement()
 	if err != nil || announcement == nil {
-		box.Hide()
-		c.Refresh()
+		if !hasAnnouncement(ann) {
+			announcementCache, err := getAnnouncementCache()
+			if err != nil || announcementCache == nil {
+				box.Hide()
+				c.Refresh()
+				return
+			}
+			ann = announcementCache.Announcement
+			annTime = announcementCache.Time
+		}
+		title.SetText(fmt.Sprintf("公告（无法连接服务器，以下为%s获取的公告）", timeutil.TimestampToDateTime(annTime)))
+		renderAnnouncement(list, box, c)
 		return
 	}
-	content := ""
-	if announcement.Content != "" {
-		content = announcement.Content
-		ann.Hash = announcement.Hash
+	if announcement == ann || (announcement.Content == "" && len(announcement.Items) == 0 && announcement.Hash != "" && announcement.Hash == ann.Hash) {
+		// 未变化时沿用当前公告
+		announcement = ann
 	} else {
-		if announcement.Hash != "" {
-			if ann.Hash == announcement.Hash {
-				content = ann.Content
+		prevHash := ann.Hash
+		if prevHash == "" {
+			// 启动后首次获取时与上次运行时的公告比较
+			announcementCache, err := getAnnouncementCache()
+			if err == nil && announcementCache != nil {
+				prevHash = announcementCache.Announcement.Hash
 			}
 		}
+		notifyAnnouncement(prevHash, announcement)
+
+		annTime = time.Now().Unix()
+		err = saveAnnouncementCache(&AnnouncementCache{
+			Announcement: announcement,
+			Time:         annTime,
+		})
+		if err != nil {
+			log.Warnf("save announcement cache failed, err: %v\n", err)
+		}
 	}
+	ann = announcement
+	title.SetText("公告")
 
-	ann.Content = content
+	renderAnnouncement(list, box, c)
+}
 
-	if content == "" {
+func getAnnouncementCacheFilePath() (string, error) {
+	dataDirPath, err := getDataDirPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDirPath, "announcement-cache.json"), nil
+}
+
+// getAnnouncementCache 没有缓存时返回nil
+func getAnnouncementCache() (*AnnouncementCache, error) {
+	path, err := getAnnouncementCacheFilePath()
+	if err != nil {
+		return nil, err
+	}
+	var announcementCache *AnnouncementCache
+	isExist, err := readDataFile(path, &announcementCache)
+	if err != nil || !isExist || announcementCache == nil || announcementCache.Announcement == nil {
+		return nil, err
+	}
+	return announcementCache, nil
+}
+
+func saveAnnouncementCache(announcementCache *AnnouncementCache) error {
+	path, err := getAnnouncementCacheFilePath()
+	if err != nil {
+		return err
+	}
+	return writeDataFile(path, announcementCache)
+}
+
+// renderAnnouncement 显示未过期且未被关闭的公告，公告的显示时间每次刷新时重新判断
+func renderAnnouncement(list *fyne.Container, box *fyne.Container, c *fyne.Container) {
+	dismissed, err := getDismissedAnnouncements()
+	if err != nil {
+		log.Warnf("get dismissed announcements failed, err: %v\n", err)
+	}
+	items := getVisibleAnnouncementItems(ann, dismissed, time.Now().Unix())
+
+	list.Objects = nil
+	for _, item := range items {
+		list.Add(newAnnouncementItemView(item, func(id string) {
+			err := dismissAnnouncement(id)
+			if err != nil {
+				log.Warnf("dismiss announcement failed, err: %v\n", err)
+			}
+			renderAnnouncement(list, box, c)
+		}))
+	}
+	list.Refresh()
+
+	if len(items) == 0 {
 		box.Hide()
-		c.Refresh()
 	} else {
-		w.SetText(content)
 		box.Show()
-		c.Refresh()
 	}
+	c.Refresh()
+}
+
+func newAnnouncementItemView(item *AnnouncementItem, onDismiss func(id string)) fyne.CanvasObject {
+	var body fyne.CanvasObject
+	if item.isPlainText {
+		label := widget.NewLabel(item.Content)
+		label.Wrapping = fyne.TextWrapWord
+		body = label
+	} else {
+		richText := widget.NewRichTextFromMarkdown(item.Content)
+		richText.Wrapping = fyne.TextWrapWord
+		body = richText
+	}
+
+	title := item.Title
+	switch item.Severity {
+	case AnnouncementSeverityUrgent:
+		title = "【紧急】" + title
+	case AnnouncementSeverityWarning:
+		title = "【重要】" + title
+	}
+	if item.PublishTime > 0 {
+		title = fmt.Sprintf("%s  %s", title, timeutil.TimestampToDate(item.PublishTime))
+	}
+	titleLabel := widget.NewLabelWithStyle(title, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	dismissBtn := widget.NewButton("不再显示", func() {
+		onDismiss(item.Id)
+	})
+	header := container.NewBorder(nil, nil, nil, dismissBtn, titleLabel)
+	return container.NewVBox(header, body, widget.NewSeparator())
 }
 
+// getAnnouncementItems 所有公告，旧版服务器的纯文本公告作为一条公告，没有id的公告使用标题和内容的hash作为id
+func getAnnouncementItems(announcement *Announcement) []*AnnouncementItem {
+	items := make([]*AnnouncementItem, 0)
+	if announcement.Content != "" {
+		items = append(items, &AnnouncementItem{
+			Id:          announcement.Hash,
+			Content:     announcement.Content,
+			Severity:    AnnouncementSeverityInfo,
+			isPlainText: true,
+		})
+	}
+	items = append(items, announcement.Items...)
+	for _, item := range items {
+		if item.Id == "" {
+			item.Id = md5util.SumString(item.Title + "\n" + item.Content)
+		}
+	}
+	return items
+}
+
+// getVisibleAnnouncementItems 过滤未发布、已过期及已关闭的公告，紧急公告在前，其他按发布时间倒序
+func getVisibleAnnouncementItems(announcement *Announcement, dismissed map[string]int64, now int64) []*AnnouncementItem {
+	items := getAnnouncementItems(announcement)
+	visibleItems := make([]*AnnouncementItem, 0, len(items))
+	for _, item := range items {
+		if item.PublishTime > 0 && item.PublishTime > now {
+			continue
+		}
+		if item.ExpireTime > 0 && item.ExpireTime <= now {
+			continue
+		}
+		if _, ok := dismissed[item.Id]; ok {
+			continue
+		}
+		visibleItems = append(visibleItems, item)
+	}
+	sort.SliceStable(visibleItems, func(i, j int) bool {
+		isUrgentI := visibleItems[i].Severity == AnnouncementSeverityUrgent
+		isUrgentJ := visibleItems[j].Severity == AnnouncementSeverityUrgent
+		if isUrgentI != isUrgentJ {
+			return isUrgentI
+		}
+		return visibleItems[i].PublishTime > visibleItems[j].PublishTime
+	})
+	return visibleItems
+}
+
+func getDismissedAnnouncementsFilePath() (string, error) {
+	dataDirPath, err := getDataDirPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDirPath, "announcement-dismissed.json"), nil
+}
+
+// getDismissedAnnouncements 已关闭的公告，key为公告id，value为关闭时间
+func getDismissedAnnouncements() (map[string]int64, error) {
+	dismissed := make(map[string]int64)
+	path, err := getDismissedAnnouncementsFilePath()
+	if err != nil {
+		return dismissed, err
+	}
+	_, err = readDataFile(path, &dismissed)
+	return dismissed, err
+}
+
+func dismissAnnouncement(id string) error {
+	dismissed, err := getDismissedAnnouncements()
+	if err != nil {
+		log.Warnf("get dismissed announcements failed, err: %v\n", err)
+	}
+	dismissed[id] = time.Now().Unix()
+	// 只保留当前公告中的记录
+	ids := make(map[string]bool)
+	for _, item := range getAnnouncementItems(ann) {
+		ids[item.Id] = true
+	}
+	for k := range dismissed {
+		if !ids[k] {
+			delete(dismissed, k)
+		}
+	}
+	path, err := getDismissedAnnouncementsFilePath()
+	if err != nil {
+		return err
+	}
+	return writeDataFile(path, dismissed)
+}
+
+// annETag 最近一次获取公告时服务器返回的ETag
+var annETag = ""
+
 func getAnnouncement() (*Announcement, error) {
-	j, err := fetchAnnouncement()
+	j, isNotModified, err := fetchAnnouncement()
 	if err != nil {
 		log.Debugf("request failed, err: %v\n", err)
 		return nil, err
 	}
+	if isNotModified {
+		// 未变化时直接返回当前公告
+		return ann, nil
+	}
 	var announcement *Announcement
 	err = json.Unmarshal([]byte(j), &announcement)
 	if err != nil {
@@ -60,18 +276,39 @@ func getAnnouncement() (*Announcement, error) {
 	return announcement, nil
 }
 
-func fetchAnnouncement() (string, error) {
+// fetchAnnouncement 有当前公告时带上If-None-Match，服务器返回304时isNotModified为true
+func fetchAnnouncement() (string, bool, error) {
 	finalUrl := ""
-	if ann.Content != "" {
+	if hasAnnouncement(ann) {
 		q := url.Values{}
 		q.Set("hash", ann.Hash)
 		finalUrl = fmt.Sprintf("%s%s", getFullUrl("/announcement"), "?"+q.Encode())
 	} else {
 		finalUrl = getFullUrl("/announcement")
 	}
-	j, err := httpGet(finalUrl)
+	req, err := http.NewRequest(http.MethodGet, finalUrl, nil)
 	if err != nil {
-		return "", err
+		return "", false, err
+	}
+	if hasAnnouncement(ann) && annETag != "" {
+		req.Header.Set("If-None-Match", annETag)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", false, err
 	}
-	return j, nil
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return "", true, nil
+	}
+	j, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", false, err
+	}
+	annETag = resp.Header.Get("ETag")
+	return string(j), false, nil
+}
+
+func hasAnnouncement(announcement *Announcement) bool {
+	return announcement.Content != "" || len(announcement.Items) > 0
 }
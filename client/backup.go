@@ -0,0 +1,199 @@
+package client
+
+import (
+	"fmt"
+	"github.com/comoyi/valheim-launcher/config"
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/comoyi/valheim-launcher/util/fsutil"
+	"github.com/comoyi/valheim-launcher/util/ziputil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const saveBackupPrefix = "saves-"
+const saveBackupSuffix = ".zip"
+const saveBackupTimeLayout = "20060102-150405.000"
+
+// 需要备份的存档文件夹，worlds和characters为旧版本游戏的存档位置
+var saveDirNames = []string{
+	"worlds_local",
+	"characters_local",
+	"worlds",
+	"characters",
+}
+
+type SaveBackup struct {
+	Name string
+	Path string
+	Time time.Time
+	Size int64
+}
+
+// backupSaves 备份存档并删除多余的旧备份，返回备份文件路径，没有存档时返回空字符串
+func backupSaves() (string, error) {
+	backupPath, err := createSaveBackup()
+	if err != nil {
+		return "", err
+	}
+
+	err = rotateSaveBackups()
+	if err != nil {
+		log.Warnf("rotate save backups failed, err: %v\n", err)
+	}
+	return backupPath, nil
+}
+
+func createSaveBackup() (string, error) {
+	ironGateDir, err := getIronGateDir()
+	if err != nil {
+		return "", err
+	}
+
+	relativePaths := make([]string, 0)
+	for _, name := range saveDirNames {
+		exists, err := fsutil.Exists(filepath.Join(ironGateDir, name))
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			relativePaths = append(relativePaths, name)
+		}
+	}
+	if len(relativePaths) == 0 {
+		log.Debugf("no saves to backup, ironGateDir: %s\n", ironGateDir)
+		return "", nil
+	}
+
+	backupDirPath, err := getSaveBackupDirPath()
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(backupDirPath, os.ModePerm)
+	if err != nil {
+		log.Debugf("create backup dir failed, dir: %s, err: %v\n", backupDirPath, err)
+		return "", err
+	}
+
+	backupName := fmt.Sprintf("%s%s%s", saveBackupPrefix, time.Now().Format(saveBackupTimeLayout), saveBackupSuffix)
+	backupPath := filepath.Join(backupDirPath, backupName)
+	err = ziputil.Compress(backupPath, ironGateDir, relativePaths)
+	if err != nil {
+		log.Debugf("compress saves failed, backupPath: %s, err: %v\n", backupPath, err)
+		_ = os.Remove(backupPath)
+		return "", err
+	}
+	log.Debugf("backup saves, backupPath: %s\n", backupPath)
+	return backupPath, nil
+}
+
+// rotateSaveBackups 删除超出保留数量的旧备份
+func rotateSaveBackups() error {
+	keep := config.Conf.SaveBackupKeep
+	if keep <= 0 {
+		return nil
+	}
+	backups, err := listSaveBackups()
+	if err != nil {
+		return err
+	}
+	if len(backups) <= keep {
+		return nil
+	}
+	for _, backup := range backups[keep:] {
+		err = os.Remove(backup.Path)
+		if err != nil {
+			return err
+		}
+		log.Debugf("[DELETE]delete old save backup, path: %s\n", backup.Path)
+	}
+	return nil
+}
+
+// listSaveBackups 获取所有存档备份，最新的在前
+func listSaveBackups() ([]*SaveBackup, error) {
+	backupDirPath, err := getSaveBackupDirPath()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(backupDirPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	backups := make([]*SaveBackup, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, saveBackupPrefix) || !strings.HasSuffix(name, saveBackupSuffix) {
+			continue
+		}
+		t, err := time.ParseInLocation(saveBackupTimeLayout, strings.TrimSuffix(strings.TrimPrefix(name, saveBackupPrefix), saveBackupSuffix), time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, &SaveBackup{
+			Name: name,
+			Path: filepath.Join(backupDirPath, name),
+			Time: t,
+			Size: info.Size(),
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+	return backups, nil
+}
+
+// restoreSaveBackup 恢复存档，恢复前先备份当前存档（不删除旧备份，避免删掉要恢复的备份）
+// 备份后清空当前的存档文件夹再解压，避免备份之后新建的存档残留
+func restoreSaveBackup(backup *SaveBackup) error {
+	ironGateDir, err := getIronGateDir()
+	if err != nil {
+		return err
+	}
+
+	_, err = createSaveBackup()
+	if err != nil {
+		log.Warnf("backup current saves before restore failed, err: %v\n", err)
+		return err
+	}
+
+	for _, name := range saveDirNames {
+		path := filepath.Join(ironGateDir, name)
+		err = os.RemoveAll(path)
+		if err != nil {
+			log.Warnf("clear save dir before restore failed, path: %s, err: %v\n", path, err)
+			return err
+		}
+		log.Debugf("[DELETE]clear save dir before restore, path: %s\n", path)
+	}
+
+	err = ziputil.Extract(backup.Path, ironGateDir)
+	if err != nil {
+		log.Warnf("restore saves failed, backupPath: %s, err: %v\n", backup.Path, err)
+		return err
+	}
+	log.Debugf("restore saves, backupPath: %s\n", backup.Path)
+	return nil
+}
+
+func getSaveBackupDirPath() (string, error) {
+	backupDir := config.Conf.SaveBackupDir
+
+	backupDirPath, err := filepath.Abs(backupDir)
+	if err != nil {
+		log.Debugf("get backup dir absolute path failed, backup dir: %s, err: %v\n", backupDir, err)
+		return "", err
+	}
+
+	return backupDirPath, nil
+}
@@ -0,0 +1,269 @@
+package client
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"github.com/comoyi/valheim-launcher/config"
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/comoyi/valheim-launcher/util/cryptoutil/md5util"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// 离线更新包（zip）
+// manifest.json 服务器返回的原始文件列表
+// manifest.sig  文件列表的签名，服务器未签名时不存在
+// deltas.json   在文件列表基础上依次应用的增量（含各自的签名），没有增量时不存在
+// links.json    符号链接的目标，key为统一使用/分隔的相对路径
+// files/<hash>  文件内容，相同hash的文件只保存一份
+
+const bundleManifestName = "manifest.json"
+const bundleSignatureName = "manifest.sig"
+const bundleDeltasName = "deltas.json"
+const bundleLinksName = "links.json"
+const bundleFilesDir = "files/"
+
+var errNoSyncRecord = fmt.Errorf("没有同步记录，请先更新")
+
+// bundleSource 从离线更新包获取文件列表和文件
+type bundleSource struct {
+	path  string
+	zr    *zip.ReadCloser
+	files map[string]*zip.File
+	links map[string]string
+}
+
+func openBundle(path string) (*bundleSource, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &bundleSource{
+		path:  path,
+		zr:    zr,
+		files: make(map[string]*zip.File),
+		links: make(map[string]string),
+	}
+	for _, f := range zr.File {
+		s.files[f.Name] = f
+	}
+	if _, ok := s.files[bundleManifestName]; !ok {
+		zr.Close()
+		return nil, fmt.Errorf("%s not found in %s", bundleManifestName, path)
+	}
+	if f, ok := s.files[bundleLinksName]; ok {
+		content, err := readZipFile(f)
+		if err != nil {
+			zr.Close()
+			return nil, err
+		}
+		err = json.Unmarshal(content, &s.links)
+		if err != nil {
+			zr.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *bundleSource) String() string {
+	return "离线更新包"
+}
+
+func (s *bundleSource) getServerManifest() (*ServerManifest, error) {
+	content, err := readZipFile(s.files[bundleManifestName])
+	if err != nil {
+		return nil, err
+	}
+	manifest := &ServerManifest{
+		Content: string(content),
+	}
+	if f, ok := s.files[bundleSignatureName]; ok {
+		signature, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Signature = string(signature)
+	}
+	if f, ok := s.files[bundleDeltasName]; ok {
+		content, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(content, &manifest.Deltas)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+func (s *bundleSource) openFile(fileInfo *FileInfo) (io.ReadCloser, error) {
+	f, ok := s.files[bundleFilesDir+fileInfo.Hash]
+	if !ok {
+		log.Warnf("file not found in bundle, file: %s, hash: %s\n", fileInfo.RelativePath, fileInfo.Hash)
+		return nil, fmt.Errorf("离线更新包中缺少文件：%s", fileInfo.RelativePath)
+	}
+	return f.Open()
+}
+
+func (s *bundleSource) readLink(fileInfo *FileInfo) (string, error) {
+	dest, ok := s.links[normalizeRelativePath(filepath.Clean(fileInfo.RelativePath))]
+	if !ok {
+		return "", fmt.Errorf("离线更新包中缺少文件：%s", fileInfo.RelativePath)
+	}
+	return dest, nil
+}
+
+func (s *bundleSource) close() error {
+	return s.zr.Close()
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// exportBundle 将游戏文件夹最近一次同步的文件列表及所有文件导出为离线更新包，优先从缓存读取文件
+// 返回缓存和游戏文件夹中都没有的文件（例如未启用的可选MOD）
+func exportBundle(baseDir string, writer io.Writer) ([]string, error) {
+	syncRecord, err := getSyncRecord(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	if syncRecord == nil || syncRecord.Manifest == nil {
+		return nil, errNoSyncRecord
+	}
+	manifest := syncRecord.Manifest
+	serverFileInfo, err := parseServerManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	var cacheInfo *CacheInfo
+	if config.Conf.IsUseCache {
+		cacheInfo, err = getCacheInfo()
+		if err != nil {
+			log.Warnf("get cache info failed, err: %v\n", err)
+		}
+	}
+
+	zw := zip.NewWriter(writer)
+	err = writeZipFile(zw, bundleManifestName, []byte(manifest.Content))
+	if err != nil {
+		zw.Close()
+		return nil, err
+	}
+	if manifest.Signature != "" {
+		err = writeZipFile(zw, bundleSignatureName, []byte(manifest.Signature))
+		if err != nil {
+			zw.Close()
+			return nil, err
+		}
+	}
+
+	if len(manifest.Deltas) > 0 {
+		content, err := json.Marshal(manifest.Deltas)
+		if err != nil {
+			zw.Close()
+			return nil, err
+		}
+		err = writeZipFile(zw, bundleDeltasName, content)
+		if err != nil {
+			zw.Close()
+			return nil, err
+		}
+	}
+
+	missingFiles := make([]string, 0)
+	links := make(map[string]string)
+	hashes := make(map[string]bool)
+	for _, file := range serverFileInfo.Files {
+		switch file.Type {
+		case TypeFile:
+			if hashes[file.Hash] {
+				continue
+			}
+			path, ok := findBundleSrcFile(baseDir, file, cacheInfo)
+			if !ok {
+				log.Debugf("[SKIP]file not found in cache and game dir, file: %s\n", file.RelativePath)
+				missingFiles = append(missingFiles, file.RelativePath)
+				continue
+			}
+			err = addBundleFile(zw, bundleFilesDir+file.Hash, path)
+			if err != nil {
+				zw.Close()
+				return nil, err
+			}
+			hashes[file.Hash] = true
+		case TypeSymlink:
+			dest, err := os.Readlink(filepath.Join(baseDir, file.RelativePath))
+			if err != nil {
+				missingFiles = append(missingFiles, file.RelativePath)
+				continue
+			}
+			links[normalizeRelativePath(filepath.Clean(file.RelativePath))] = dest
+		}
+	}
+
+	if len(links) > 0 {
+		content, err := json.Marshal(links)
+		if err != nil {
+			zw.Close()
+			return nil, err
+		}
+		err = writeZipFile(zw, bundleLinksName, content)
+		if err != nil {
+			zw.Close()
+			return nil, err
+		}
+	}
+	return missingFiles, zw.Close()
+}
+
+// findBundleSrcFile 查找hash一致的文件，先查缓存，再查游戏文件夹
+func findBundleSrcFile(baseDir string, file *FileInfo, cacheInfo *CacheInfo) (string, bool) {
+	isCacheHit, cachePath, _ := checkCache(file, cacheInfo)
+	if isCacheHit {
+		return cachePath, true
+	}
+	localPath := filepath.Join(baseDir, file.RelativePath)
+	isBelong, err := isBelongDir(localPath, baseDir)
+	if err != nil || !isBelong {
+		return "", false
+	}
+	hashSum, err := md5util.SumFile(localPath)
+	if err != nil || hashSum != file.Hash {
+		return "", false
+	}
+	return localPath, true
+}
+
+func addBundleFile(zw *zip.Writer, name string, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func writeZipFile(zw *zip.Writer, name string, content []byte) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
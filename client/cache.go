@@ -12,9 +12,13 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
+// cacheDbMutex 更新和后台预下载可能同时读写缓存数据库
+var cacheDbMutex = &sync.Mutex{}
+
 type CacheInfo struct {
 	GenerateTimestamp int64                 `json:"generate_timestamp"`
 	GenerateTime      string                `json:"generate_time"`
@@ -100,6 +104,12 @@ func generateCacheDb() error {
 }
 
 func writeCacheDb(cacheInfo *CacheInfo) error {
+	cacheDbMutex.Lock()
+	defer cacheDbMutex.Unlock()
+	return doWriteCacheDb(cacheInfo)
+}
+
+func doWriteCacheDb(cacheInfo *CacheInfo) error {
 	if cacheInfo == nil {
 		log.Debugf("writeCacheDb failed, err: cacheInfo is nil\n")
 		return fmt.Errorf("cacheInfo is nil")
@@ -141,7 +151,10 @@ func writeCacheDb(cacheInfo *CacheInfo) error {
 }
 
 func addCacheDbData(hashSum string, cacheFile *CacheFile) (*CacheInfo, error) {
-	cacheInfo, err := getCacheInfo()
+	cacheDbMutex.Lock()
+	defer cacheDbMutex.Unlock()
+
+	cacheInfo, err := doGetCacheInfo()
 	if err != nil {
 		return nil, err
 	}
@@ -152,7 +165,7 @@ func addCacheDbData(hashSum string, cacheFile *CacheFile) (*CacheInfo, error) {
 		cacheInfo.UpdateTimestamp = nowTimestamp
 		cacheInfo.UpdateTime = nowDateTime
 		cacheInfo.Files[hashSum] = cacheFile
-		err = writeCacheDb(cacheInfo)
+		err = doWriteCacheDb(cacheInfo)
 		if err != nil {
 			return nil, err
 		}
@@ -183,6 +196,12 @@ func getCacheInfoFilePath() (string, error) {
 }
 
 func getCacheInfo() (*CacheInfo, error) {
+	cacheDbMutex.Lock()
+	defer cacheDbMutex.Unlock()
+	return doGetCacheInfo()
+}
+
+func doGetCacheInfo() (*CacheInfo, error) {
 	cacheInfoFilePath, err := getCacheInfoFilePath()
 	if err != nil {
 		log.Debugf("get CacheInfoFilePath failed, err: %v\n", err)
@@ -307,6 +326,11 @@ func generateCacheFile(localPath string, hashSum string, fileType FileType) (*Ca
 	}
 	defer f.Close()
 
+	return writeCacheFile(f, hashSum, fileType)
+}
+
+// writeCacheFile 将src写入新的缓存文件，不写入缓存数据库
+func writeCacheFile(src io.Reader, hashSum string, fileType FileType) (*CacheFile, error) {
 	cacheDirPath, err := getCacheDirPath()
 	if err != nil {
 		return nil, err
@@ -331,9 +355,16 @@ func generateCacheFile(localPath string, hashSum string, fileType FileType) (*Ca
 	}
 	defer file.Close()
 
-	_, err = io.Copy(file, f)
+	_, err = io.Copy(file, src)
 	if err != nil {
 		log.Debugf("write cache file failed, cacheFilePath: %s, err: %v\n", cacheFilePath, err)
+		_ = file.Close()
+		_ = os.Remove(cacheFilePath)
+		return nil, err
+	}
+	err = file.Close()
+	if err != nil {
+		_ = os.Remove(cacheFilePath)
 		return nil, err
 	}
 
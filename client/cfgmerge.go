@@ -0,0 +1,284 @@
+package client
+
+import (
+	"fmt"
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/comoyi/valheim-launcher/util/cryptoutil/md5util"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BepInEx配置文件（类INI格式）的三方合并
+// base为上次同步时服务器的版本，server为服务器的新版本，local为本地文件
+// 服务器修改的配置项以服务器为准，只有玩家修改的配置项保留玩家的值，双方都修改的配置项以服务器为准并提示冲突
+
+type cfgKey struct {
+	Section string
+	Key     string
+}
+
+type cfgLine struct {
+	Raw     string
+	Section string
+	Key     string
+	Value   string
+	IsEntry bool
+}
+
+type cfgDoc struct {
+	Lines   []*cfgLine
+	Values  map[cfgKey]string
+	Entries []*cfgLine
+	Newline string
+}
+
+type CfgConflict struct {
+	Section     string
+	Key         string
+	LocalValue  string
+	ServerValue string
+}
+
+func isMergeableConfigFile(relativePath string) bool {
+	p := strings.ToLower(filepath.ToSlash(relativePath))
+	return strings.HasPrefix(p, "bepinex/config/") && strings.HasSuffix(p, ".cfg")
+}
+
+func parseCfg(content string) *cfgDoc {
+	doc := &cfgDoc{
+		Lines:   make([]*cfgLine, 0),
+		Values:  make(map[cfgKey]string),
+		Entries: make([]*cfgLine, 0),
+		Newline: "\n",
+	}
+	if strings.Contains(content, "\r\n") {
+		doc.Newline = "\r\n"
+	}
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.TrimSuffix(content, "\n")
+
+	section := ""
+	for _, raw := range strings.Split(content, "\n") {
+		line := &cfgLine{Raw: raw, Section: section}
+		trimmed := strings.TrimSpace(raw)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			line.Section = section
+		} else if trimmed != "" && !strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(trimmed, ";") {
+			i := strings.Index(trimmed, "=")
+			if i > 0 {
+				line.IsEntry = true
+				line.Key = strings.TrimSpace(trimmed[:i])
+				line.Value = strings.TrimSpace(trimmed[i+1:])
+				k := cfgKey{Section: section, Key: line.Key}
+				if _, ok := doc.Values[k]; !ok {
+					doc.Entries = append(doc.Entries, line)
+				}
+				doc.Values[k] = line.Value
+			}
+		}
+		doc.Lines = append(doc.Lines, line)
+	}
+	return doc
+}
+
+// mergeCfg 合并配置文件，hasBase为false时（没有上一版本）无法判断哪一方修改过，本地已有的配置项保留本地的值，只新增服务器的配置项
+func mergeCfg(base string, hasBase bool, server string, local string) (string, []*CfgConflict) {
+	baseDoc := parseCfg(base)
+	serverDoc := parseCfg(server)
+	localDoc := parseCfg(local)
+
+	conflicts := make([]*CfgConflict, 0)
+	results := make(map[cfgKey]string)
+	removed := make(map[cfgKey]bool)
+
+	for _, line := range serverDoc.Entries {
+		k := cfgKey{Section: line.Section, Key: line.Key}
+		s := serverDoc.Values[k]
+		l, inLocal := localDoc.Values[k]
+		b, inBase := baseDoc.Values[k]
+		if !inLocal || l == s {
+			results[k] = s
+			continue
+		}
+		if !hasBase {
+			results[k] = l
+			continue
+		}
+		if inBase && s == b {
+			// 只有玩家修改
+			results[k] = l
+		} else if inBase && l == b {
+			// 只有服务器修改
+			results[k] = s
+		} else {
+			results[k] = s
+			conflicts = append(conflicts, &CfgConflict{Section: k.Section, Key: k.Key, LocalValue: l, ServerValue: s})
+		}
+	}
+
+	extras := make([]*cfgLine, 0)
+	for _, line := range localDoc.Entries {
+		k := cfgKey{Section: line.Section, Key: line.Key}
+		if _, ok := serverDoc.Values[k]; ok {
+			continue
+		}
+		b, inBase := baseDoc.Values[k]
+		if !hasBase || !inBase {
+			// 玩家新增的配置项
+			extras = append(extras, line)
+			continue
+		}
+		// 服务器删除了该配置项
+		removed[k] = true
+		if line.Value != b {
+			conflicts = append(conflicts, &CfgConflict{Section: k.Section, Key: k.Key, LocalValue: line.Value, ServerValue: ""})
+		}
+	}
+
+	return renderCfg(serverDoc, results, extras), conflicts
+}
+
+func renderCfg(serverDoc *cfgDoc, results map[cfgKey]string, extras []*cfgLine) string {
+	extrasBySection := make(map[string][]*cfgLine)
+	sectionOrder := make([]string, 0)
+	for _, line := range extras {
+		if _, ok := extrasBySection[line.Section]; !ok {
+			sectionOrder = append(sectionOrder, line.Section)
+		}
+		extrasBySection[line.Section] = append(extrasBySection[line.Section], line)
+	}
+
+	out := make([]string, 0, len(serverDoc.Lines)+len(extras))
+	flushed := make(map[string]bool)
+	flush := func(section string, insertAt int) {
+		if flushed[section] {
+			return
+		}
+		flushed[section] = true
+		lines := extrasBySection[section]
+		if len(lines) == 0 {
+			return
+		}
+		inserted := make([]string, 0, len(lines))
+		for _, line := range lines {
+			inserted = append(inserted, line.Raw)
+		}
+		out = append(out[:insertAt], append(inserted, out[insertAt:]...)...)
+	}
+
+	section := ""
+	lastContentIndex := 0
+	for _, line := range serverDoc.Lines {
+		if line.Section != section {
+			flush(section, lastContentIndex)
+			section = line.Section
+		}
+		raw := line.Raw
+		if line.IsEntry {
+			k := cfgKey{Section: line.Section, Key: line.Key}
+			if v, ok := results[k]; ok && v != line.Value {
+				raw = fmt.Sprintf("%s = %s", line.Key, v)
+			}
+		}
+		out = append(out, raw)
+		if strings.TrimSpace(raw) != "" {
+			lastContentIndex = len(out)
+		}
+	}
+	flush(section, lastContentIndex)
+
+	for _, s := range sectionOrder {
+		if flushed[s] {
+			continue
+		}
+		flushed[s] = true
+		if len(out) > 0 {
+			out = append(out, "")
+		}
+		if s != "" {
+			out = append(out, fmt.Sprintf("[%s]", s))
+		}
+		for _, line := range extrasBySection[s] {
+			out = append(out, line.Raw)
+		}
+	}
+
+	return strings.Join(out, serverDoc.Newline) + serverDoc.Newline
+}
+
+// getConfigBasePath 获取配置文件上次同步时服务器版本的保存路径
+func getConfigBasePath(baseDir string, relativePath string) (string, error) {
+	dirDataPath, err := getDirDataPath(baseDir)
+	if err != nil {
+		return "", err
+	}
+	basePath := filepath.Join(dirDataPath, "cfg-base", relativePath)
+	isBelong, err := isBelongDir(basePath, dirDataPath)
+	if err != nil {
+		return "", err
+	}
+	if !isBelong {
+		return "", errNotInBaseDir
+	}
+	return basePath, nil
+}
+
+func readConfigBase(baseDir string, relativePath string) (string, bool, error) {
+	basePath, err := getConfigBasePath(baseDir, relativePath)
+	if err != nil {
+		return "", false, err
+	}
+	content, err := os.ReadFile(basePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return string(content), true, nil
+}
+
+func saveConfigBase(baseDir string, relativePath string, content []byte) error {
+	basePath, err := getConfigBasePath(baseDir, relativePath)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(basePath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(basePath, content, 0o644)
+	if err != nil {
+		log.Debugf("save config base failed, basePath: %s, err: %v\n", basePath, err)
+		return err
+	}
+	return nil
+}
+
+// readConfigBaseFromCache 没有保存的上一版本时，使用同步记录中的版本在缓存中的文件
+func readConfigBaseFromCache(serverFileInfo *FileInfo, baseDir string, cacheInfo *CacheInfo) (string, bool) {
+	recordFile, cachePath, ok := getSyncedCachePath(serverFileInfo, baseDir, cacheInfo)
+	if !ok {
+		return "", false
+	}
+	content, err := os.ReadFile(cachePath)
+	if err != nil {
+		log.Debugf("read config base from cache failed, cachePath: %s, err: %v\n", cachePath, err)
+		return "", false
+	}
+	if md5util.SumString(string(content)) != recordFile.Hash {
+		log.Debugf("config base in cache hash mismatch, cachePath: %s\n", cachePath)
+		return "", false
+	}
+	return string(content), true
+}
+
+func saveConfigBaseFromFile(baseDir string, relativePath string, localPath string) error {
+	content, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	return saveConfigBase(baseDir, relativePath, content)
+}
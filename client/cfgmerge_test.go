@@ -0,0 +1,153 @@
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+const testCfgBase = `## Settings file
+[General]
+
+## Enable the mod
+Enabled = true
+
+# Key to open the menu
+MenuKey = F1
+
+[Graphics]
+Quality = 2
+`
+
+func TestParseCfg(t *testing.T) {
+	doc := parseCfg(strings.ReplaceAll(testCfgBase, "\n", "\r\n"))
+	if doc.Newline != "\r\n" {
+		t.Errorf("unexpected newline: %q", doc.Newline)
+	}
+	expected := map[cfgKey]string{
+		{Section: "General", Key: "Enabled"}:  "true",
+		{Section: "General", Key: "MenuKey"}:  "F1",
+		{Section: "Graphics", Key: "Quality"}: "2",
+	}
+	if len(doc.Values) != len(expected) {
+		t.Errorf("unexpected values: %v", doc.Values)
+	}
+	for k, v := range expected {
+		if doc.Values[k] != v {
+			t.Errorf("unexpected value for %v: %q, expected: %q", k, doc.Values[k], v)
+		}
+	}
+	if len(doc.Entries) != 3 || doc.Entries[2].Section != "Graphics" {
+		t.Errorf("unexpected entries: %+v", doc.Entries)
+	}
+	// 注释和空行原样保留
+	if len(doc.Lines) != len(strings.Split(strings.TrimSuffix(testCfgBase, "\n"), "\n")) {
+		t.Errorf("unexpected line count: %d", len(doc.Lines))
+	}
+}
+
+func TestRenderCfg(t *testing.T) {
+	doc := parseCfg(testCfgBase)
+	results := map[cfgKey]string{
+		{Section: "General", Key: "MenuKey"}: "F2",
+	}
+	extras := []*cfgLine{
+		{Raw: "Extra = 1", Section: "General", Key: "Extra", Value: "1", IsEntry: true},
+		{Raw: "Volume = 5", Section: "Audio", Key: "Volume", Value: "5", IsEntry: true},
+	}
+	rendered := renderCfg(doc, results, extras)
+	expected := `## Settings file
+[General]
+
+## Enable the mod
+Enabled = true
+
+# Key to open the menu
+MenuKey = F2
+Extra = 1
+
+[Graphics]
+Quality = 2
+
+[Audio]
+Volume = 5
+`
+	if rendered != expected {
+		t.Errorf("unexpected rendered cfg:\n%s", rendered)
+	}
+	if renderCfg(doc, nil, nil) != testCfgBase {
+		t.Errorf("render without changes should keep the original content")
+	}
+}
+
+func TestMergeCfgServerChanged(t *testing.T) {
+	server := strings.Replace(testCfgBase, "Quality = 2", "Quality = 3", 1)
+	local := strings.Replace(testCfgBase, "MenuKey = F1", "MenuKey = F5", 1)
+	merged, conflicts := mergeCfg(testCfgBase, true, server, local)
+	values := parseCfg(merged).Values
+	if values[cfgKey{Section: "Graphics", Key: "Quality"}] != "3" {
+		t.Errorf("server change not applied:\n%s", merged)
+	}
+	if values[cfgKey{Section: "General", Key: "MenuKey"}] != "F5" {
+		t.Errorf("user change not kept:\n%s", merged)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("unexpected conflicts: %+v", conflicts)
+	}
+}
+
+func TestMergeCfgUserOnly(t *testing.T) {
+	local := strings.Replace(testCfgBase, "Enabled = true", "Enabled = false", 1) + "Custom = x\n"
+	merged, conflicts := mergeCfg(testCfgBase, true, testCfgBase, local)
+	if merged != local {
+		t.Errorf("user only changes should be kept, got:\n%s", merged)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("unexpected conflicts: %+v", conflicts)
+	}
+}
+
+func TestMergeCfgConflict(t *testing.T) {
+	server := strings.Replace(testCfgBase, "MenuKey = F1", "MenuKey = F2", 1)
+	local := strings.Replace(testCfgBase, "MenuKey = F1", "MenuKey = F5", 1)
+	merged, conflicts := mergeCfg(testCfgBase, true, server, local)
+	if parseCfg(merged).Values[cfgKey{Section: "General", Key: "MenuKey"}] != "F2" {
+		t.Errorf("conflict should use server value:\n%s", merged)
+	}
+	if len(conflicts) != 1 || conflicts[0].Key != "MenuKey" || conflicts[0].LocalValue != "F5" || conflicts[0].ServerValue != "F2" {
+		t.Errorf("unexpected conflicts: %+v", conflicts)
+	}
+
+	// 服务器删除了玩家修改过的配置项
+	server = strings.Replace(testCfgBase, "Quality = 2\n", "", 1)
+	local = strings.Replace(testCfgBase, "Quality = 2", "Quality = 4", 1)
+	merged, conflicts = mergeCfg(testCfgBase, true, server, local)
+	if _, ok := parseCfg(merged).Values[cfgKey{Section: "Graphics", Key: "Quality"}]; ok {
+		t.Errorf("removed key should be removed:\n%s", merged)
+	}
+	if len(conflicts) != 1 || conflicts[0].ServerValue != "" {
+		t.Errorf("unexpected conflicts: %+v", conflicts)
+	}
+}
+
+func TestMergeCfgNoBase(t *testing.T) {
+	server := strings.Replace(testCfgBase, "Quality = 2", "Quality = 3", 1) + "NewKey = 1\n"
+	local := strings.Replace(testCfgBase, "MenuKey = F1", "MenuKey = F5", 1) + "Custom = x\n"
+	merged, conflicts := mergeCfg("", false, server, local)
+	values := parseCfg(merged).Values
+	// 没有上一版本时本地已有的配置项保留本地的值
+	if values[cfgKey{Section: "General", Key: "MenuKey"}] != "F5" {
+		t.Errorf("local value should be kept without base:\n%s", merged)
+	}
+	if values[cfgKey{Section: "Graphics", Key: "Quality"}] != "2" {
+		t.Errorf("local value should be kept without base:\n%s", merged)
+	}
+	if values[cfgKey{Section: "Graphics", Key: "NewKey"}] != "1" {
+		t.Errorf("new server key should be added:\n%s", merged)
+	}
+	if values[cfgKey{Section: "Graphics", Key: "Custom"}] != "x" {
+		t.Errorf("user key should be kept:\n%s", merged)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("unexpected conflicts: %+v", conflicts)
+	}
+}
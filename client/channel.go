@@ -0,0 +1,87 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/comoyi/valheim-launcher/config"
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/spf13/viper"
+	"net/url"
+	"strconv"
+)
+
+// 发布通道及固定版本
+// channel为空时使用服务器的默认通道，pinned_revision大于0时固定同步该版本的文件列表
+// 获取文件列表、下载文件（SERVER类型）、增量同步及服务器推送时都带上channel及revision参数
+
+// RevisionInfo 某个通道的一个文件列表版本，Time为发布时间（unix时间戳）
+type RevisionInfo struct {
+	Revision    int64  `json:"revision"`
+	Time        int64  `json:"time"`
+	Description string `json:"description"`
+}
+
+// addChannelQuery 设置了通道或固定版本时添加channel、revision参数
+func addChannelQuery(q url.Values) {
+	if config.Conf.Channel != "" {
+		q.Set("channel", config.Conf.Channel)
+	}
+	if config.Conf.PinnedRevision > 0 {
+		q.Set("revision", strconv.FormatInt(config.Conf.PinnedRevision, 10))
+	}
+}
+
+// getManifestCacheKey 不同通道及固定版本的文件列表分别缓存
+func getManifestCacheKey() string {
+	key := config.Conf.Channel
+	if config.Conf.PinnedRevision > 0 {
+		key = fmt.Sprintf("%s@%d", key, config.Conf.PinnedRevision)
+	}
+	return key
+}
+
+// getRevisions 获取通道的历史版本，按发布时间倒序
+func getRevisions(channel string) ([]*RevisionInfo, error) {
+	q := url.Values{}
+	if channel != "" {
+		q.Set("channel", channel)
+	}
+	j, err := httpGet(fmt.Sprintf("%s?%s", getFullUrl("/revisions"), q.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	var revisions []*RevisionInfo
+	err = json.Unmarshal([]byte(j), &revisions)
+	if err != nil {
+		log.Debugf("json.Unmarshal failed, err: %v\n", err)
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func saveChannelConfig(channel string, pinnedRevision int64) error {
+	viper.Set("channel", channel)
+	viper.Set("pinned_revision", pinnedRevision)
+	err := config.SaveConfig()
+	if err != nil {
+		log.Debugf("save config failed, err: %+v\n", err)
+		return err
+	}
+	config.Conf.Channel = channel
+	config.Conf.PinnedRevision = pinnedRevision
+	return nil
+}
+
+func formatChannel(channel string) string {
+	if channel == "" {
+		return "默认"
+	}
+	return channel
+}
+
+func formatPinnedRevision(pinnedRevision int64) string {
+	if pinnedRevision <= 0 {
+		return "最新版本"
+	}
+	return fmt.Sprintf("版本%d", pinnedRevision)
+}
@@ -1,6 +1,9 @@
 package client
 
 import (
+	"context"
+	"fmt"
+	"github.com/comoyi/valheim-launcher/config"
 	"github.com/comoyi/valheim-launcher/log"
 )
 
@@ -9,7 +12,43 @@ var appName = "Valheim Launcher"
 func Start() {
 	log.Debugf("Client start\n")
 
+	initDownloadRateLimit()
+
 	initUI()
 
+	finishSelfUpdate()
+
+	if config.Conf.IsLanShare {
+		err := startLanShare(context.Background())
+		if err != nil {
+			addMsgWithTime("局域网共享启动失败")
+		} else {
+			addMsgWithTime(fmt.Sprintf("局域网共享已开启，端口：%d", config.Conf.LanSharePort))
+		}
+	}
+
+	if config.Conf.IsPrefetch {
+		startPrefetch(context.Background())
+	}
+
+	go func() {
+		_, err := handshake()
+		if err != nil {
+			addMsgWithTime(err.Error())
+		}
+		if config.Conf.IsWatchServerEvents {
+			startServerEventWatch(context.Background())
+		}
+		if config.Conf.IsCheckLauncherUpdate {
+			v, err := checkNewVersion()
+			if err != nil {
+				log.Debugf("check new version failed, err: %v\n", err)
+			} else if v != nil {
+				addMsgWithTime(fmt.Sprintf("启动器有新版本：%s", v.Version))
+				showNewVersionDialog(v)
+			}
+		}
+	}()
+
 	w.ShowAndRun()
 }
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// 预压缩文件的扩展名
+var compressionExts = map[string]string{
+	CompressionGzip: ".gz",
+	CompressionZstd: ".zst",
+}
+
+// downloadFile 从随机的DownloadServer下载文件，返回解压后的内容
+// SERVER类型通过Accept-Encoding协商压缩格式（只请求服务器支持的格式），OSS类型根据文件列表中的compression字段下载预压缩的文件
+func downloadFile(fileInfo *FileInfo) (io.ReadCloser, error) {
+	downloadServer := getRandomDownloadServer()
+	if downloadServer.Type == DownloadServerTypeOss {
+		ext, ok := compressionExts[fileInfo.Compression]
+		if ok {
+			rc, err := doDownloadFile(getDownloadUrlByFile(downloadServer, fileInfo.RelativePath+ext), "", fileInfo.Compression)
+			if err == nil {
+				return rc, nil
+			}
+			log.Debugf("download precompressed file failed, try uncompressed file, file: %s, err: %v\n", fileInfo.RelativePath, err)
+		}
+		return doDownloadFile(getDownloadUrlByFile(downloadServer, fileInfo.RelativePath), "", "")
+	}
+	return doDownloadFile(getDownloadUrlByFile(downloadServer, fileInfo.RelativePath), getAcceptEncoding(), "")
+}
+
+// doDownloadFile compression为空时根据响应的Content-Encoding解压
+func doDownloadFile(u string, accept string, compression string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept-Encoding", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if compression != "" && resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	if compression == "" && !resp.Uncompressed {
+		compression = strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	}
+	if resp.Uncompressed && compression == CompressionGzip {
+		// 对象设置了Content-Encoding: gzip时http包已自动解压
+		compression = ""
+	}
+	log.Debugf("download from: %s, compression: %s\n", u, compression)
+	return newDecompressReadCloser(newLimitedReadCloser(resp.Body), compression)
+}
+
+type decompressReadCloser struct {
+	io.Reader
+	closeFunc func() error
+}
+
+func (r *decompressReadCloser) Close() error {
+	return r.closeFunc()
+}
+
+// newDecompressReadCloser 流式解压，关闭时同时关闭rc
+func newDecompressReadCloser(rc io.ReadCloser, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case "", "identity":
+		return rc, nil
+	case CompressionGzip:
+		gr, err := gzip.NewReader(rc)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return &decompressReadCloser{
+			Reader: gr,
+			closeFunc: func() error {
+				_ = gr.Close()
+				return rc.Close()
+			},
+		}, nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(rc)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return &decompressReadCloser{
+			Reader: zr,
+			closeFunc: func() error {
+				zr.Close()
+				return rc.Close()
+			},
+		}, nil
+	}
+	rc.Close()
+	return nil, fmt.Errorf("unsupported compression: %s", compression)
+}
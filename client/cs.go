@@ -17,18 +17,79 @@ const (
 	TypeSymlink FileType = 4
 )
 
+// ServerFileInfo IsDelta为true时为相对BaseRevision的增量，Files为新增或修改的文件，RemovedFiles为删除的文件
+// MinLauncherVersion 同步该文件列表要求的最低启动器版本，为空时不限制
 type ServerFileInfo struct {
-	ScanStatus ScanStatus  `json:"status"`
-	Files      []*FileInfo `json:"files"`
+	ScanStatus         ScanStatus              `json:"status"`
+	Files              []*FileInfo             `json:"files"`
+	GameVersion        *GameVersionRequirement `json:"game_version"`
+	ModGroups          []*ModGroup             `json:"mod_groups"`
+	Revision           int64                   `json:"revision"`
+	BaseRevision       int64                   `json:"base_revision"`
+	IsDelta            bool                    `json:"is_delta"`
+	RemovedFiles       []string                `json:"removed_files"`
+	MinLauncherVersion string                  `json:"min_launcher_version"`
+}
+
+// GameVersionRequirement MOD包适用的游戏版本，BuildIds为Steam的buildid
+// IsStrict只对BuildIds生效：buildid不一致时阻止更新，MinVersion、MaxVersion来自游戏日志，不一致时只提示
+type GameVersionRequirement struct {
+	BuildIds   []string `json:"build_ids"`
+	MinVersion string   `json:"min_version"`
+	MaxVersion string   `json:"max_version"`
+	IsStrict   bool     `json:"is_strict"`
+}
+
+type ModGroupMode int8
+
+const (
+	ModGroupModeRequired    ModGroupMode = 1
+	ModGroupModeOptionalOn  ModGroupMode = 2
+	ModGroupModeOptionalOff ModGroupMode = 3
+)
+
+// ModGroup MOD分组，Paths为该分组包含的文件或文件夹的相对路径
+type ModGroup struct {
+	Id          string       `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Mode        ModGroupMode `json:"mode"`
+	Paths       []string     `json:"paths"`
 }
 
 type FileInfo struct {
 	RelativePath string   `json:"relative_path"`
 	Type         FileType `json:"type"`
 	Hash         string   `json:"hash"`
+	// Compression OSS上预压缩的文件的压缩格式（gzip、zstd），对应的文件为原路径加.gz或.zst，Hash为解压后内容的hash
+	Compression string `json:"compression,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	// BlockSize 大于0时服务器提供该文件的块签名，可以增量同步
+	BlockSize int `json:"block_size,omitempty"`
 }
 
+// Announcement 公告，Hash未变化时服务器返回的Content和Items为空
+// Content为旧版服务器的纯文本公告，Items为多条公告
 type Announcement struct {
-	Content string `json:"content"`
-	Hash    string `json:"hash"`
+	Content string              `json:"content"`
+	Hash    string              `json:"hash"`
+	Items   []*AnnouncementItem `json:"items"`
+}
+
+const (
+	AnnouncementSeverityInfo    = "info"
+	AnnouncementSeverityWarning = "warning"
+	AnnouncementSeverityUrgent  = "urgent"
+)
+
+// AnnouncementItem 一条公告，Content为Markdown
+// PublishTime、ExpireTime为unix时间戳，0代表不限制，紧急公告置顶显示
+type AnnouncementItem struct {
+	Id          string `json:"id"`
+	Title       string `json:"title"`
+	Content     string `json:"content"`
+	Severity    string `json:"severity"`
+	PublishTime int64  `json:"publish_time"`
+	ExpireTime  int64  `json:"expire_time"`
+	isPlainText bool
 }
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/comoyi/valheim-launcher/config"
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/comoyi/valheim-launcher/util/cryptoutil/md5util"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var dataMutex = &sync.Mutex{}
+
+var errDataDirNotSet = fmt.Errorf("data dir is not set")
+
+// getDataDirPath data_dir为空时返回错误，避免数据文件写到当前工作目录
+func getDataDirPath() (string, error) {
+	dataDir := config.Conf.DataDir
+	if dataDir == "" {
+		log.Warnf("data dir is empty\n")
+		return "", errDataDirNotSet
+	}
+
+	dataDirPath, err := filepath.Abs(dataDir)
+	if err != nil {
+		log.Debugf("get data dir absolute path failed, data dir: %s, err: %v\n", dataDir, err)
+		return "", err
+	}
+
+	return dataDirPath, nil
+}
+
+// getDirDataPath 获取某个游戏文件夹对应的数据文件夹
+func getDirDataPath(baseDir string) (string, error) {
+	dataDirPath, err := getDataDirPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDirPath, "dirs", md5util.SumString(filepath.Clean(baseDir))), nil
+}
+
+// readDataFile 读取数据文件并解码到v，文件不存在时返回false
+func readDataFile(path string, v interface{}) (bool, error) {
+	dataMutex.Lock()
+	defer dataMutex.Unlock()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		log.Debugf("read data file failed, path: %s, err: %v\n", path, err)
+		return false, err
+	}
+	err = json.Unmarshal(content, v)
+	if err != nil {
+		log.Debugf("decode data file failed, path: %s, err: %v\n", path, err)
+		return false, err
+	}
+	return true, nil
+}
+
+// writeDataFile 编码v并写入数据文件，先写临时文件再重命名，防止写入中断导致文件损坏
+func writeDataFile(path string, v interface{}) error {
+	dataMutex.Lock()
+	defer dataMutex.Unlock()
+
+	content, err := json.Marshal(v)
+	if err != nil {
+		log.Debugf("json encode failed, err: %v\n", err)
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	err = os.WriteFile(tmpPath, content, 0o644)
+	if err != nil {
+		log.Debugf("write data file failed, path: %s, err: %v\n", tmpPath, err)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
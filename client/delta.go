@@ -0,0 +1,223 @@
+package client
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/comoyi/valheim-launcher/config"
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/comoyi/valheim-launcher/util/deltautil"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// 增量同步
+// 服务器为大文件提供块签名（文件列表中block_size大于0），只下载本地文件或缓存中没有的块（HTTP Range），其他块从本地复制
+
+// FileSignature 文件的块签名，由 /signature?file=<relative_path> 获取
+type FileSignature struct {
+	BlockSize int               `json:"block_size"`
+	Blocks    []*BlockSignature `json:"blocks"`
+}
+
+// BlockSignature Weak为rsync的弱校验和，Strong为块内容的md5
+type BlockSignature struct {
+	Weak   uint32 `json:"weak"`
+	Strong string `json:"strong"`
+}
+
+func isDeltaSyncable(fileInfo *FileInfo) bool {
+	return fileInfo.BlockSize > 0 && fileInfo.Size > int64(fileInfo.BlockSize)
+}
+
+func getFileSignature(fileInfo *FileInfo) (*FileSignature, error) {
+	q := url.Values{}
+	q.Set("file", fileInfo.RelativePath)
+	addChannelQuery(q)
+	j, err := httpGet(getFullUrl("/signature?" + q.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	var signature *FileSignature
+	err = json.Unmarshal([]byte(j), &signature)
+	if err != nil {
+		return nil, err
+	}
+	if signature == nil || signature.BlockSize != fileInfo.BlockSize {
+		return nil, fmt.Errorf("invalid signature")
+	}
+	blockCount := (fileInfo.Size + int64(fileInfo.BlockSize) - 1) / int64(fileInfo.BlockSize)
+	if int64(len(signature.Blocks)) != blockCount {
+		return nil, fmt.Errorf("invalid signature, expected blocks: %d, got: %d", blockCount, len(signature.Blocks))
+	}
+	return signature, nil
+}
+
+// getDeltaBasisPath 用于复制块的旧文件，优先使用游戏文件夹中的文件，其次使用缓存中上次同步的版本
+func getDeltaBasisPath(fileInfo *FileInfo, baseDir string, localPath string, cacheInfo *CacheInfo) (string, bool) {
+	fi, err := os.Lstat(localPath)
+	if err == nil && fi.Mode().IsRegular() {
+		return localPath, true
+	}
+	_, cachePath, ok := getSyncedCachePath(fileInfo, baseDir, cacheInfo)
+	return cachePath, ok
+}
+
+// syncFileByDelta 增量同步文件，先写入临时文件，校验hash后替换localPath
+func syncFileByDelta(fileInfo *FileInfo, baseDir string, localPath string, cacheInfo *CacheInfo) error {
+	basisPath, ok := getDeltaBasisPath(fileInfo, baseDir, localPath, cacheInfo)
+	if !ok {
+		return fmt.Errorf("no basis file")
+	}
+	signature, err := getFileSignature(fileInfo)
+	if err != nil {
+		return err
+	}
+
+	basisFile, err := os.Open(basisPath)
+	if err != nil {
+		return err
+	}
+	defer basisFile.Close()
+
+	blocks := make([]*deltautil.Block, 0, len(signature.Blocks))
+	for _, block := range signature.Blocks {
+		blocks = append(blocks, &deltautil.Block{
+			Weak:   block.Weak,
+			Strong: block.Strong,
+		})
+	}
+	found, err := deltautil.FindBlocks(basisFile, signature.BlockSize, blocks)
+	if err != nil {
+		return err
+	}
+	log.Debugf("[DELTA]file: %s, blocks: %d, matched: %d\n", fileInfo.RelativePath, len(blocks), len(found))
+
+	tmpPath := localPath + ".vldelta"
+	isBelong, err := isBelongDir(tmpPath, baseDir)
+	if err != nil {
+		return err
+	}
+	if !isBelong {
+		return errNotInBaseDir
+	}
+	err = os.MkdirAll(filepath.Dir(tmpPath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	tmpFile, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	defer tmpFile.Close()
+
+	h := md5.New()
+	w := io.MultiWriter(tmpFile, h)
+	downloadServer := getRandomDownloadServer()
+	blockSize := int64(signature.BlockSize)
+	blockCount := len(signature.Blocks)
+	for i := 0; i < blockCount; {
+		if offset, ok := found[i]; ok {
+			length := blockSize
+			if int64(i+1)*blockSize > fileInfo.Size {
+				length = fileInfo.Size - int64(i)*blockSize
+			}
+			_, err = io.Copy(w, io.NewSectionReader(basisFile, offset, length))
+			if err != nil {
+				return err
+			}
+			i++
+			continue
+		}
+		// 合并连续缺少的块，一次请求下载
+		j := i
+		for j < blockCount {
+			if _, ok := found[j]; ok {
+				break
+			}
+			j++
+		}
+		start := int64(i) * blockSize
+		end := int64(j)*blockSize - 1
+		if end >= fileInfo.Size {
+			end = fileInfo.Size - 1
+		}
+		err = downloadRange(downloadServer, fileInfo, start, end, w)
+		if err != nil {
+			return err
+		}
+		i = j
+	}
+
+	hashSum := hex.EncodeToString(h.Sum(nil))
+	if hashSum != fileInfo.Hash {
+		return fmt.Errorf("delta file hash check failed, expected: %s, got: %s", fileInfo.Hash, hashSum)
+	}
+	err = tmpFile.Close()
+	if err != nil {
+		return err
+	}
+	// basisFile通常就是localPath，Windows上不能替换仍打开的文件，重命名前先关闭
+	err = basisFile.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, localPath)
+}
+
+// trySyncFileByDelta 从服务器同步且缓存未命中时尝试增量同步，成功时返回true
+func trySyncFileByDelta(fileInfo *FileInfo, baseDir string, localPath string, cacheInfo *CacheInfo, source fileSource) bool {
+	if _, ok := source.(*serverSource); !ok || !isDeltaSyncable(fileInfo) || !getServerInfo().IsDeltaSupported {
+		return false
+	}
+	if config.Conf.IsUseCache {
+		isCacheHit, _, _ := checkCache(fileInfo, cacheInfo)
+		if isCacheHit {
+			return false
+		}
+	}
+	err := syncFileByDelta(fileInfo, baseDir, localPath, cacheInfo)
+	if err != nil {
+		log.Debugf("delta sync failed, download whole file, file: %s, err: %v\n", fileInfo.RelativePath, err)
+		return false
+	}
+	if config.Conf.IsUseCache {
+		_, err = tryGenerateCacheFile(localPath, fileInfo.Hash, TypeFile, cacheInfo)
+		if err != nil {
+			log.Debugf("generate cache file failed, file: %s, err: %v\n", fileInfo.RelativePath, err)
+		}
+	}
+	return true
+}
+
+// downloadRange 下载文件的[start, end]部分，服务器不支持Range时返回错误
+func downloadRange(downloadServer *config.DownloadServer, fileInfo *FileInfo, start int64, end int64, w io.Writer) error {
+	req, err := http.NewRequest(http.MethodGet, getDownloadUrlByFile(downloadServer, fileInfo.RelativePath), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	req.Header.Set("Accept-Encoding", "identity")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("range not supported, status code: %d", resp.StatusCode)
+	}
+	body := newLimitedReadCloser(resp.Body)
+	n, err := io.Copy(w, io.LimitReader(body, end-start+1))
+	if err != nil {
+		return err
+	}
+	if n != end-start+1 {
+		return fmt.Errorf("unexpected range length, expected: %d, got: %d", end-start+1, n)
+	}
+	return nil
+}
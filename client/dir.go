@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/comoyi/valheim-launcher/log"
 	"os"
+	"path/filepath"
 	"runtime"
 )
 
@@ -57,3 +58,16 @@ func getWindowsPossibleDirs() []string {
 	dirs = append(dirs, ds...)
 	return dirs
 }
+
+// getIronGateDir 获取英灵神殿存档所在文件夹
+func getIronGateDir() (string, error) {
+	userHomeDir, err := os.UserHomeDir()
+	if err != nil {
+		log.Warnf("Get os.UserHomeDir failed, err: %v\n", err)
+		return "", err
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(userHomeDir, "AppData", "LocalLow", "IronGate", "Valheim"), nil
+	}
+	return filepath.Join(userHomeDir, ".config", "unity3d", "IronGate", "Valheim"), nil
+}
@@ -0,0 +1,285 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/comoyi/valheim-launcher/config"
+	"github.com/comoyi/valheim-launcher/log"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 服务器推送
+// 优先订阅 /events （SSE），服务器不支持时使用 /status 长轮询，用于等待服务器刷新文件列表完成及获知MOD包新版本
+
+var errServerEventsNotSupported = fmt.Errorf("server events not supported")
+
+// 长轮询时服务器最多等待的时间（单位：秒）
+const serverStatusPollTimeout = 30
+
+// 连接断开后重新连接的间隔
+const serverEventRetryInterval = 5 * time.Second
+
+// 更新时等待服务器刷新文件列表的最长时间
+const serverScanWaitTimeout = 30 * time.Minute
+
+// 等待服务器刷新文件列表后重新更新的最小间隔
+const serverScanRetryInterval = 3 * time.Second
+
+var errServerScanTimeout = fmt.Errorf("等待服务器刷新文件列表超时，请稍后再试")
+
+// ServerEvent 服务器的扫描状态及文件列表版本，扫描中时Scanned、Total为已扫描及总文件数（服务器不支持时为0）
+type ServerEvent struct {
+	ScanStatus ScanStatus `json:"status"`
+	Revision   int64      `json:"revision"`
+	Scanned    int64      `json:"scanned"`
+	Total      int64      `json:"total"`
+}
+
+// watchServerEvents 持续接收服务器状态变化，handler返回false时停止
+// 连接断开时自动重连，服务器不支持推送及长轮询时返回errServerEventsNotSupported
+func watchServerEvents(ctx context.Context, handler func(event *ServerEvent) bool) error {
+	if !getServerInfo().IsEventsSupported {
+		return errServerEventsNotSupported
+	}
+	isSseSupported := true
+	var last *ServerEvent
+	for {
+		var err error
+		isStopped := false
+		h := func(event *ServerEvent) bool {
+			last = event
+			isStopped = !handler(event)
+			return !isStopped
+		}
+		if isSseSupported {
+			err = subscribeServerEvents(ctx, h)
+			if err == errServerEventsNotSupported {
+				log.Debugf("sse not supported, use long poll\n")
+				isSseSupported = false
+				continue
+			}
+		} else {
+			err = pollServerStatus(ctx, last, h)
+			if err == errServerEventsNotSupported {
+				return err
+			}
+		}
+		if isStopped {
+			return nil
+		}
+		if err != nil {
+			log.Debugf("watch server events failed, err: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(serverEventRetryInterval):
+		}
+	}
+}
+
+// subscribeServerEvents 订阅SSE，只处理data字段，连接断开时返回
+func subscribeServerEvents(ctx context.Context, handler func(event *ServerEvent) bool) error {
+	q := url.Values{}
+	if config.Conf.Channel != "" {
+		q.Set("channel", config.Conf.Channel)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s?%s", getFullUrl("/events"), q.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return errServerEventsNotSupported
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	data := make([]string, 0)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			if strings.HasPrefix(line, "data:") {
+				data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			}
+			continue
+		}
+		// 空行为一个事件的结束
+		if len(data) == 0 {
+			continue
+		}
+		var event *ServerEvent
+		err = json.Unmarshal([]byte(strings.Join(data, "\n")), &event)
+		data = data[:0]
+		if err != nil || event == nil {
+			log.Debugf("invalid server event, err: %v\n", err)
+			continue
+		}
+		if !handler(event) {
+			return nil
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// pollServerStatus 长轮询，带上当前已知的状态，服务器在状态变化或超时后返回
+func pollServerStatus(ctx context.Context, last *ServerEvent, handler func(event *ServerEvent) bool) error {
+	client := &http.Client{
+		Timeout: (serverStatusPollTimeout + 30) * time.Second,
+	}
+	for {
+		q := url.Values{}
+		q.Set("timeout", strconv.Itoa(serverStatusPollTimeout))
+		if config.Conf.Channel != "" {
+			q.Set("channel", config.Conf.Channel)
+		}
+		if last != nil {
+			q.Set("since", strconv.FormatInt(last.Revision, 10))
+			q.Set("status", strconv.Itoa(int(last.ScanStatus)))
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s?%s", getFullUrl("/status"), q.Encode()), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		content, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return errServerEventsNotSupported
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+		var event *ServerEvent
+		err = json.Unmarshal(content, &event)
+		if err != nil || event == nil {
+			return fmt.Errorf("invalid server status, err: %v", err)
+		}
+		if last != nil && *event == *last {
+			// 超时未变化，避免服务器不等待直接返回时频繁请求
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		last = event
+		if !handler(event) {
+			return nil
+		}
+	}
+}
+
+// waitServerScanCompleted 等待服务器刷新文件列表完成，期间在界面上显示扫描进度
+// 服务器不支持推送及长轮询时每隔3秒重新获取文件列表
+func waitServerScanCompleted(ctx context.Context) error {
+	var scanErr error
+	var lastMsgTime time.Time
+	err := watchServerEvents(ctx, func(event *ServerEvent) bool {
+		switch event.ScanStatus {
+		case ScanStatusCompleted:
+			return false
+		case ScanStatusFailed:
+			scanErr = fmt.Errorf("服务器刷新文件列表失败")
+			return false
+		case ScanStatusScanning:
+			if event.Total > 0 && time.Since(lastMsgTime) >= 10*time.Second {
+				lastMsgTime = time.Now()
+				addMsgWithTime(fmt.Sprintf("服务器正在刷新文件列表（%d/%d）", event.Scanned, event.Total))
+			}
+		}
+		return true
+	})
+	if err != errServerEventsNotSupported {
+		if err != nil {
+			return err
+		}
+		return scanErr
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(3 * time.Second):
+		}
+		serverFileInfo, err := getServerFileInfo()
+		if err != nil {
+			log.Debugf("get server file info failed, err: %v\n", err)
+			continue
+		}
+		switch serverFileInfo.ScanStatus {
+		case ScanStatusCompleted:
+			return nil
+		case ScanStatusFailed:
+			return fmt.Errorf("服务器刷新文件列表失败")
+		}
+	}
+}
+
+// startServerEventWatch 后台接收当前通道的服务器状态，文件列表版本比游戏文件夹上次同步的版本新时提示更新并发送桌面通知
+// 服务器不支持推送时定时获取文件列表
+func startServerEventWatch(ctx context.Context) {
+	go func() {
+		var notifiedRevision int64
+		err := watchServerEvents(ctx, func(event *ServerEvent) bool {
+			// 固定版本时不提示新版本
+			if event.ScanStatus != ScanStatusCompleted || event.Revision <= notifiedRevision || config.Conf.PinnedRevision > 0 {
+				return true
+			}
+			if event.Revision > getSyncedRevision() {
+				addMsgWithTime(fmt.Sprintf("MOD包有新版本（版本：%d），请更新MOD", event.Revision))
+				notifyNewRevision(event.Revision)
+				notifiedRevision = event.Revision
+			}
+			return true
+		})
+		if err == errServerEventsNotSupported {
+			log.Debugf("server events not supported, poll server revision\n")
+			pollServerRevision(ctx)
+			return
+		}
+		if err != nil {
+			log.Debugf("watch server events stopped, err: %v\n", err)
+		}
+	}()
+}
+
+// getSyncedRevision 当前游戏文件夹上次同步的文件列表版本，没有同步记录时为0
+func getSyncedRevision() int64 {
+	baseDir := config.Conf.Dir
+	if baseDir == "" {
+		return 0
+	}
+	syncRecord, err := getSyncRecord(filepath.Clean(baseDir))
+	if err != nil || syncRecord == nil {
+		return 0
+	}
+	return syncRecord.Revision
+}
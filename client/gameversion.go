@@ -0,0 +1,165 @@
+package client
+
+import (
+	"fmt"
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/comoyi/valheim-launcher/util/versionutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const valheimSteamAppId = "892970"
+
+var errGameVersionMismatch = fmt.Errorf("game version mismatch")
+
+var buildIdRegexp = regexp.MustCompile(`"buildid"\s+"(\d+)"`)
+var gameVersionRegexp = regexp.MustCompile(`Valheim version:\s*(?:[a-zA-Z]+-)?(\d+(?:\.\d+)+)`)
+
+type GameVersion struct {
+	BuildId string
+	Version string
+}
+
+func (v *GameVersion) String() string {
+	parts := make([]string, 0, 2)
+	if v.Version != "" {
+		parts = append(parts, v.Version)
+	}
+	if v.BuildId != "" {
+		parts = append(parts, fmt.Sprintf("build %s", v.BuildId))
+	}
+	if len(parts) == 0 {
+		return "未知"
+	}
+	return strings.Join(parts, " / ")
+}
+
+// checkGameVersion 检查本地游戏版本是否满足MOD包的要求，严格模式下只有buildid不一致时返回errGameVersionMismatch
+func checkGameVersion(baseDir string, requirement *GameVersionRequirement) error {
+	if requirement == nil {
+		return nil
+	}
+	if len(requirement.BuildIds) == 0 && requirement.MinVersion == "" && requirement.MaxVersion == "" {
+		return nil
+	}
+
+	if requirement.IsStrict && len(requirement.BuildIds) == 0 {
+		log.Warnf("is_strict only applies to build_ids, version range is advisory, requirement: %+v\n", requirement)
+	}
+
+	localVersion := getLocalGameVersion(baseDir)
+	log.Debugf("local game version: %+v, requirement: %+v\n", localVersion, requirement)
+
+	// buildid来自Steam的appmanifest，Steam更新后立即变化，获取到时以buildid为准，只有buildid不一致时才会阻止更新
+	if len(requirement.BuildIds) > 0 && localVersion.BuildId != "" {
+		for _, buildId := range requirement.BuildIds {
+			if buildId == localVersion.BuildId {
+				return nil
+			}
+		}
+		msg := fmt.Sprintf("MOD包要求的游戏版本为 %s，本地游戏版本为 %s", requirement, localVersion)
+		if requirement.IsStrict {
+			addMsgWithTime(msg + "，请先通过Steam将游戏更新到对应版本")
+			return errGameVersionMismatch
+		}
+		addMsgWithTime(msg + "，更新后游戏可能无法正常运行")
+		return nil
+	}
+
+	// 游戏日志中的版本号在Steam更新后、游戏再次启动前不会变化，只作为参考，不阻止更新
+	if (requirement.MinVersion != "" || requirement.MaxVersion != "") && localVersion.Version != "" {
+		isMatch := true
+		if requirement.MinVersion != "" && versionutil.Compare(localVersion.Version, requirement.MinVersion) < 0 {
+			isMatch = false
+		}
+		if requirement.MaxVersion != "" && versionutil.Compare(localVersion.Version, requirement.MaxVersion) > 0 {
+			isMatch = false
+		}
+		if !isMatch {
+			addMsgWithTime(fmt.Sprintf("MOD包要求的游戏版本为 %s，最近一次运行的游戏版本为 %s（来自游戏日志，Steam更新后需启动一次游戏才会变化，仅供参考），如未更新游戏请先通过Steam更新", requirement, localVersion.Version))
+		}
+		return nil
+	}
+
+	addMsgWithTime("无法获取本地游戏版本，跳过游戏版本检查")
+	return nil
+}
+
+func (r *GameVersionRequirement) String() string {
+	parts := make([]string, 0, 2)
+	if r.MinVersion != "" && r.MinVersion == r.MaxVersion {
+		parts = append(parts, r.MinVersion)
+	} else if r.MinVersion != "" && r.MaxVersion != "" {
+		parts = append(parts, fmt.Sprintf("%s ~ %s", r.MinVersion, r.MaxVersion))
+	} else if r.MinVersion != "" {
+		parts = append(parts, fmt.Sprintf(">= %s", r.MinVersion))
+	} else if r.MaxVersion != "" {
+		parts = append(parts, fmt.Sprintf("<= %s", r.MaxVersion))
+	}
+	if len(r.BuildIds) > 0 {
+		parts = append(parts, fmt.Sprintf("build %s", strings.Join(r.BuildIds, ", ")))
+	}
+	return strings.Join(parts, " / ")
+}
+
+func getLocalGameVersion(baseDir string) *GameVersion {
+	return &GameVersion{
+		BuildId: getLocalGameBuildId(baseDir),
+		Version: getLocalGameVersionFromLog(baseDir),
+	}
+}
+
+// getLocalGameBuildId 从Steam的appmanifest文件中获取游戏的buildid
+// 游戏文件夹一般为 steamapps/common/Valheim，appmanifest在steamapps下
+func getLocalGameBuildId(baseDir string) string {
+	steamAppsDir := filepath.Dir(filepath.Dir(baseDir))
+	manifestPath := filepath.Join(steamAppsDir, fmt.Sprintf("appmanifest_%s.acf", valheimSteamAppId))
+	content, err := os.ReadFile(manifestPath)
+	if err != nil {
+		log.Debugf("read steam app manifest failed, path: %s, err: %v\n", manifestPath, err)
+		return ""
+	}
+	matches := buildIdRegexp.FindSubmatch(content)
+	if matches == nil {
+		return ""
+	}
+	return string(matches[1])
+}
+
+// getLocalGameVersionFromLog 从最近的游戏日志中获取游戏版本号，是最近一次运行的版本，Steam更新后可能是旧的
+func getLocalGameVersionFromLog(baseDir string) string {
+	logPaths := []string{
+		filepath.Join(baseDir, "BepInEx", "LogOutput.log"),
+	}
+	ironGateDir, err := getIronGateDir()
+	if err == nil {
+		logPaths = append(logPaths, filepath.Join(ironGateDir, "Player.log"))
+	}
+
+	version := ""
+	var lastModTime time.Time
+	for _, logPath := range logPaths {
+		fi, err := os.Stat(logPath)
+		if err != nil {
+			continue
+		}
+		if !fi.ModTime().After(lastModTime) {
+			continue
+		}
+		content, err := os.ReadFile(logPath)
+		if err != nil {
+			log.Debugf("read game log failed, path: %s, err: %v\n", logPath, err)
+			continue
+		}
+		matches := gameVersionRegexp.FindSubmatch(content)
+		if matches == nil {
+			continue
+		}
+		version = string(matches[1])
+		lastModTime = fi.ModTime()
+	}
+	return version
+}
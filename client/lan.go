@@ -0,0 +1,326 @@
+package client
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/comoyi/valheim-launcher/config"
+	"github.com/comoyi/valheim-launcher/log"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 局域网共享
+// 开启后通过HTTP在局域网内提供缓存中的文件（按hash获取），并通过UDP广播发现其他开启了共享的启动器
+// 下载文件时先尝试从局域网内的其他启动器获取，hash校验不通过或获取失败时再从DownloadServer下载
+
+const lanFilesPath = "/lan/files/"
+const lanAnnounceApp = "valheim-launcher-lan"
+const lanAnnounceInterval = 10 * time.Second
+const lanPeerExpire = 3 * lanAnnounceInterval
+const lanRequestTimeout = 5 * time.Second
+
+var lanHashPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// LanAnnounce 广播的内容
+type LanAnnounce struct {
+	App  string `json:"app"`
+	Id   string `json:"id"`
+	Port int    `json:"port"`
+}
+
+type LanPeer struct {
+	Address  string
+	LastSeen time.Time
+}
+
+var lanId string
+var lanPeers = make(map[string]*LanPeer)
+var lanPeersMutex = &sync.Mutex{}
+
+// startLanShare 启动局域网共享服务和节点发现
+func startLanShare(ctx context.Context) error {
+	if !config.Conf.IsUseCache {
+		log.Warnf("lan share requires cache, is_use_cache is false\n")
+		return fmt.Errorf("lan share requires cache")
+	}
+	lanId = newLanId()
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", config.Conf.LanSharePort))
+	if err != nil {
+		log.Warnf("lan share listen failed, port: %d, err: %v\n", config.Conf.LanSharePort, err)
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(lanFilesPath, handleLanFile)
+	server := &http.Server{
+		Handler:     mux,
+		ReadTimeout: lanRequestTimeout,
+	}
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.Warnf("lan share server stopped, err: %v\n", err)
+		}
+	}()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: config.Conf.LanDiscoveryPort})
+	if err != nil {
+		log.Warnf("lan discovery listen failed, port: %d, err: %v\n", config.Conf.LanDiscoveryPort, err)
+		_ = server.Close()
+		return err
+	}
+	go receiveLanAnnounce(conn)
+	go func() {
+		for {
+			sendLanAnnounce(conn)
+			select {
+			case <-ctx.Done():
+				_ = conn.Close()
+				_ = server.Close()
+				return
+			case <-time.After(lanAnnounceInterval):
+			}
+		}
+	}()
+	log.Infof("lan share started, port: %d, discovery port: %d\n", config.Conf.LanSharePort, config.Conf.LanDiscoveryPort)
+	return nil
+}
+
+func newLanId() string {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// handleLanFile 只提供缓存中的文件，请求路径为 /lan/files/<hash>
+func handleLanFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	hashSum := strings.TrimPrefix(r.URL.Path, lanFilesPath)
+	if !lanHashPattern.MatchString(hashSum) {
+		http.NotFound(w, r)
+		return
+	}
+	cachePath, ok := getLanCachePath(hashSum)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(cachePath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	log.Debugf("[LAN]serve file, hash: %s, remote: %s\n", hashSum, r.RemoteAddr)
+	http.ServeContent(w, r, hashSum, fi.ModTime(), f)
+}
+
+func getLanCachePath(hashSum string) (string, bool) {
+	cacheInfo, err := getCacheInfo()
+	if err != nil {
+		return "", false
+	}
+	isHit, cacheFile := checkHitCache(hashSum, cacheInfo)
+	if !isHit || cacheFile == nil || cacheFile.Type != TypeFile {
+		return "", false
+	}
+	cacheDirPath, err := getCacheDirPath()
+	if err != nil {
+		return "", false
+	}
+	cachePath := filepath.Join(cacheDirPath, cacheFile.RelativePath)
+	isBelong, err := isBelongDir(cachePath, cacheDirPath)
+	if err != nil || !isBelong {
+		return "", false
+	}
+	return cachePath, true
+}
+
+func sendLanAnnounce(conn *net.UDPConn) {
+	content, err := json.Marshal(&LanAnnounce{
+		App:  lanAnnounceApp,
+		Id:   lanId,
+		Port: config.Conf.LanSharePort,
+	})
+	if err != nil {
+		return
+	}
+	for _, ip := range getBroadcastAddresses() {
+		_, err = conn.WriteToUDP(content, &net.UDPAddr{IP: ip, Port: config.Conf.LanDiscoveryPort})
+		if err != nil {
+			log.Tracef("send lan announce failed, ip: %s, err: %v\n", ip, err)
+		}
+	}
+}
+
+// getBroadcastAddresses 各网卡的广播地址以及255.255.255.255
+func getBroadcastAddresses() []net.IP {
+	ips := []net.IP{net.IPv4bcast}
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return ips
+	}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagBroadcast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip := ipNet.IP.To4()
+			if ip == nil || len(ipNet.Mask) != net.IPv4len {
+				continue
+			}
+			broadcast := make(net.IP, net.IPv4len)
+			for i := range ip {
+				broadcast[i] = ip[i] | ^ipNet.Mask[i]
+			}
+			ips = append(ips, broadcast)
+		}
+	}
+	return ips
+}
+
+func receiveLanAnnounce(conn *net.UDPConn) {
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			log.Debugf("lan discovery stopped, err: %v\n", err)
+			return
+		}
+		var announce *LanAnnounce
+		err = json.Unmarshal(buf[:n], &announce)
+		if err != nil || announce == nil || announce.App != lanAnnounceApp || announce.Id == lanId {
+			continue
+		}
+		if announce.Port <= 0 || announce.Port > 65535 {
+			continue
+		}
+		address := net.JoinHostPort(addr.IP.String(), fmt.Sprintf("%d", announce.Port))
+		lanPeersMutex.Lock()
+		if _, ok := lanPeers[announce.Id]; !ok {
+			log.Debugf("[LAN]found peer, id: %s, address: %s\n", announce.Id, address)
+		}
+		lanPeers[announce.Id] = &LanPeer{
+			Address:  address,
+			LastSeen: time.Now(),
+		}
+		lanPeersMutex.Unlock()
+	}
+}
+
+// getLanPeers 获取最近仍在广播的节点地址
+func getLanPeers() []string {
+	lanPeersMutex.Lock()
+	defer lanPeersMutex.Unlock()
+	addresses := make([]string, 0, len(lanPeers))
+	for id, peer := range lanPeers {
+		if time.Since(peer.LastSeen) > lanPeerExpire {
+			delete(lanPeers, id)
+			continue
+		}
+		addresses = append(addresses, peer.Address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// openFileFromLanPeers 依次从局域网节点获取文件，先写入临时文件并校验hash，校验通过才返回
+func openFileFromLanPeers(fileInfo *FileInfo) (io.ReadCloser, bool) {
+	if !config.Conf.IsLanShare || fileInfo.Hash == "" {
+		return nil, false
+	}
+	for _, address := range getLanPeers() {
+		f, err := downloadFromLanPeer(address, fileInfo)
+		if err != nil {
+			log.Debugf("[LAN]get file from peer failed, address: %s, file: %s, err: %v\n", address, fileInfo.RelativePath, err)
+			continue
+		}
+		log.Debugf("[LAN]get file from peer, address: %s, file: %s\n", address, fileInfo.RelativePath)
+		return f, true
+	}
+	return nil, false
+}
+
+func downloadFromLanPeer(address string, fileInfo *FileInfo) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s%s", address, lanFilesPath, fileInfo.Hash), nil)
+	if err != nil {
+		return nil, err
+	}
+	// 只限制建立连接和等待响应的时间，不限制传输大文件的时间
+	timer := time.AfterFunc(lanRequestTimeout, cancel)
+	resp, err := http.DefaultClient.Do(req)
+	timer.Stop()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	tmpFile, err := os.CreateTemp("", "valheim-launcher-lan-*")
+	if err != nil {
+		return nil, err
+	}
+	h := md5.New()
+	_, err = io.Copy(io.MultiWriter(tmpFile, h), resp.Body)
+	if err == nil {
+		hashSum := hex.EncodeToString(h.Sum(nil))
+		if hashSum != fileInfo.Hash {
+			err = fmt.Errorf("hash check failed, expected: %s, got: %s", fileInfo.Hash, hashSum)
+		}
+	}
+	if err == nil {
+		_, err = tmpFile.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+		return nil, err
+	}
+	return &tmpFileReadCloser{File: tmpFile}, nil
+}
+
+// tmpFileReadCloser 关闭时删除临时文件
+type tmpFileReadCloser struct {
+	*os.File
+}
+
+func (f *tmpFileReadCloser) Close() error {
+	err := f.File.Close()
+	_ = os.Remove(f.File.Name())
+	return err
+}
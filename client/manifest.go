@@ -0,0 +1,303 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/comoyi/valheim-launcher/config"
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/comoyi/valheim-launcher/util/cryptoutil/ed25519util"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const manifestSignatureHeader = "X-Manifest-Signature"
+
+var errManifestSignature = fmt.Errorf("文件列表签名校验失败")
+var errManifestDeltaMismatch = fmt.Errorf("manifest delta base revision mismatch")
+
+// 增量累积超过该数量时重新获取完整的文件列表
+const manifestMaxDeltas = 20
+
+// ServerManifest 服务器返回的原始文件列表及其签名，签名针对Content的原始内容
+// Deltas为在完整文件列表基础上依次应用的增量，每个增量单独签名
+type ServerManifest struct {
+	Content   string            `json:"content"`
+	Signature string            `json:"signature"`
+	Deltas    []*ServerManifest `json:"deltas,omitempty"`
+}
+
+// ManifestCache 最近一次获取到的文件列表，用于增量获取，无法连接服务器时作为离线校验的文件列表
+// Time为最近一次从服务器确认该文件列表的时间
+type ManifestCache struct {
+	ETag     string          `json:"etag"`
+	Revision int64           `json:"revision"`
+	Manifest *ServerManifest `json:"manifest"`
+	Time     int64           `json:"time"`
+}
+
+// manifestHeader 用于在校验签名前判断返回的是否为增量
+type manifestHeader struct {
+	ScanStatus   ScanStatus `json:"status"`
+	Revision     int64      `json:"revision"`
+	BaseRevision int64      `json:"base_revision"`
+	IsDelta      bool       `json:"is_delta"`
+}
+
+func getManifestCacheFilePath() (string, error) {
+	dataDirPath, err := getDataDirPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDirPath, "manifest-cache.json"), nil
+}
+
+// manifestCacheMutex 更新、后台检查新版本及切换通道时可能同时读写文件列表缓存
+var manifestCacheMutex = &sync.Mutex{}
+
+// getManifestCaches key为getManifestCacheKey()，调用前需持有manifestCacheMutex
+func getManifestCaches() (map[string]*ManifestCache, error) {
+	path, err := getManifestCacheFilePath()
+	if err != nil {
+		return nil, err
+	}
+	manifestCaches := make(map[string]*ManifestCache)
+	_, err = readDataFile(path, &manifestCaches)
+	if err != nil {
+		return nil, err
+	}
+	return manifestCaches, nil
+}
+
+// getManifestCache 当前通道及固定版本的缓存，没有缓存时返回nil
+func getManifestCache() (*ManifestCache, error) {
+	manifestCacheMutex.Lock()
+	defer manifestCacheMutex.Unlock()
+	manifestCaches, err := getManifestCaches()
+	if err != nil {
+		return nil, err
+	}
+	manifestCache, ok := manifestCaches[getManifestCacheKey()]
+	if !ok || manifestCache == nil || manifestCache.Manifest == nil {
+		return nil, nil
+	}
+	return manifestCache, nil
+}
+
+func saveManifestCache(manifestCache *ManifestCache) error {
+	manifestCacheMutex.Lock()
+	defer manifestCacheMutex.Unlock()
+	manifestCaches, err := getManifestCaches()
+	if err != nil {
+		log.Warnf("get manifest caches failed, err: %v\n", err)
+		manifestCaches = make(map[string]*ManifestCache)
+	}
+	manifestCaches[getManifestCacheKey()] = manifestCache
+	path, err := getManifestCacheFilePath()
+	if err != nil {
+		return err
+	}
+	return writeDataFile(path, manifestCaches)
+}
+
+// fetchServerManifest 按通道及固定版本获取，有缓存时带上If-None-Match和since=<revision>，服务器未变化时直接使用缓存，返回增量时应用到缓存上
+func fetchServerManifest() (*ServerManifest, error) {
+	manifestCache, err := getManifestCache()
+	if err != nil {
+		log.Warnf("get manifest cache failed, err: %v\n", err)
+	}
+	manifest, err := doFetchServerManifest(manifestCache)
+	if errors.Is(err, errManifestDeltaMismatch) {
+		log.Debugf("manifest delta not match cache, fetch full manifest\n")
+		return doFetchServerManifest(nil)
+	}
+	return manifest, err
+}
+
+// getOfflineManifest 当前通道及固定版本最近一次获取到的文件列表及获取时间，没有时返回nil
+func getOfflineManifest() (*ServerManifest, int64) {
+	manifestCache, err := getManifestCache()
+	if err != nil || manifestCache == nil {
+		log.Debugf("no offline manifest, err: %v\n", err)
+		return nil, 0
+	}
+	return manifestCache.Manifest, manifestCache.Time
+}
+
+func doFetchServerManifest(manifestCache *ManifestCache) (*ServerManifest, error) {
+	q := url.Values{}
+	addChannelQuery(q)
+	// 固定版本时不需要增量
+	if config.Conf.PinnedRevision <= 0 && manifestCache != nil && manifestCache.Revision > 0 && len(manifestCache.Manifest.Deltas) < manifestMaxDeltas {
+		q.Set("since", strconv.FormatInt(manifestCache.Revision, 10))
+	}
+	u := getFullUrl("/files")
+	if len(q) > 0 {
+		u = fmt.Sprintf("%s?%s", u, q.Encode())
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if manifestCache != nil && manifestCache.ETag != "" {
+		req.Header.Set("If-None-Match", manifestCache.ETag)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Debugf("request failed, err: %v\n", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && manifestCache != nil {
+		log.Debugf("manifest not modified, revision: %d\n", manifestCache.Revision)
+		manifestCache.Time = time.Now().Unix()
+		err = saveManifestCache(manifestCache)
+		if err != nil {
+			log.Warnf("save manifest cache failed, err: %v\n", err)
+		}
+		return manifestCache.Manifest, nil
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Debugf("read response failed, err: %v\n", err)
+		return nil, err
+	}
+	manifest := &ServerManifest{
+		Content:   string(content),
+		Signature: resp.Header.Get(manifestSignatureHeader),
+	}
+
+	var header *manifestHeader
+	err = json.Unmarshal(content, &header)
+	if err != nil || header == nil {
+		return manifest, nil
+	}
+	if header.IsDelta {
+		if manifestCache == nil || header.BaseRevision != manifestCache.Revision {
+			return nil, errManifestDeltaMismatch
+		}
+		deltas := make([]*ServerManifest, 0, len(manifestCache.Manifest.Deltas)+1)
+		deltas = append(deltas, manifestCache.Manifest.Deltas...)
+		deltas = append(deltas, manifest)
+		manifest = &ServerManifest{
+			Content:   manifestCache.Manifest.Content,
+			Signature: manifestCache.Manifest.Signature,
+			Deltas:    deltas,
+		}
+		log.Debugf("manifest delta, base revision: %d, revision: %d\n", header.BaseRevision, header.Revision)
+	}
+
+	// 只缓存签名校验通过且扫描完成的文件列表
+	if header.ScanStatus == ScanStatusCompleted {
+		_, err = parseServerManifest(manifest)
+		if err == nil {
+			err = saveManifestCache(&ManifestCache{
+				ETag:     resp.Header.Get("ETag"),
+				Revision: header.Revision,
+				Manifest: manifest,
+				Time:     time.Now().Unix(),
+			})
+			if err != nil {
+				log.Warnf("save manifest cache failed, err: %v\n", err)
+			}
+		}
+	}
+	return manifest, nil
+}
+
+// verifyServerManifest 配置了公钥时校验签名，未配置时不校验，不校验Deltas
+func verifyServerManifest(manifest *ServerManifest) error {
+	publicKey := config.Conf.ManifestPublicKey
+	if publicKey == "" {
+		return nil
+	}
+	if manifest.Signature == "" {
+		log.Warnf("manifest signature is empty\n")
+		return errManifestSignature
+	}
+	err := ed25519util.Verify(publicKey, []byte(manifest.Content), manifest.Signature)
+	if err != nil {
+		log.Warnf("verify manifest signature failed, err: %v\n", err)
+		return errManifestSignature
+	}
+	return nil
+}
+
+// parseServerManifest 校验签名后解析文件列表，并依次应用增量
+func parseServerManifest(manifest *ServerManifest) (*ServerFileInfo, error) {
+	serverFileInfo, err := doParseServerManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	for _, delta := range manifest.Deltas {
+		deltaFileInfo, err := doParseServerManifest(delta)
+		if err != nil {
+			return nil, err
+		}
+		if !deltaFileInfo.IsDelta || deltaFileInfo.BaseRevision != serverFileInfo.Revision {
+			return nil, errManifestDeltaMismatch
+		}
+		serverFileInfo = applyManifestDelta(serverFileInfo, deltaFileInfo)
+	}
+	return serverFileInfo, nil
+}
+
+func doParseServerManifest(manifest *ServerManifest) (*ServerFileInfo, error) {
+	err := verifyServerManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	var serverFileInfo *ServerFileInfo
+	err = json.Unmarshal([]byte(manifest.Content), &serverFileInfo)
+	if err != nil {
+		log.Debugf("json.Unmarshal failed, err: %v\n", err)
+		return nil, err
+	}
+	if serverFileInfo == nil {
+		return nil, fmt.Errorf("server file info is empty")
+	}
+	return serverFileInfo, nil
+}
+
+// applyManifestDelta 删除RemovedFiles，新增或替换delta.Files，其他字段使用增量中的值
+func applyManifestDelta(base *ServerFileInfo, delta *ServerFileInfo) *ServerFileInfo {
+	removed := make(map[string]bool)
+	for _, relativePath := range delta.RemovedFiles {
+		removed[normalizeRelativePath(filepath.Clean(relativePath))] = true
+	}
+	changed := make(map[string]*FileInfo)
+	for _, file := range delta.Files {
+		changed[normalizeRelativePath(filepath.Clean(file.RelativePath))] = file
+	}
+
+	files := make([]*FileInfo, 0, len(base.Files)+len(delta.Files))
+	for _, file := range base.Files {
+		p := normalizeRelativePath(filepath.Clean(file.RelativePath))
+		if removed[p] {
+			continue
+		}
+		if changedFile, ok := changed[p]; ok {
+			files = append(files, changedFile)
+			delete(changed, p)
+			continue
+		}
+		files = append(files, file)
+	}
+	for _, file := range delta.Files {
+		if _, ok := changed[normalizeRelativePath(filepath.Clean(file.RelativePath))]; ok {
+			files = append(files, file)
+		}
+	}
+
+	result := *delta
+	result.Files = files
+	result.IsDelta = false
+	result.BaseRevision = 0
+	result.RemovedFiles = nil
+	return &result
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"github.com/comoyi/valheim-launcher/log"
+	"path/filepath"
+	"strings"
+)
+
+// ModChoices 玩家对可选MOD分组的选择，key为分组Id
+type ModChoices map[string]bool
+
+func getModChoicesFilePath() (string, error) {
+	dataDirPath, err := getDataDirPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDirPath, "mod-choices.json"), nil
+}
+
+func getModChoices() (ModChoices, error) {
+	choices := make(ModChoices)
+	path, err := getModChoicesFilePath()
+	if err != nil {
+		return choices, err
+	}
+	_, err = readDataFile(path, &choices)
+	if err != nil {
+		return make(ModChoices), err
+	}
+	return choices, nil
+}
+
+func saveModChoices(choices ModChoices) error {
+	path, err := getModChoicesFilePath()
+	if err != nil {
+		return err
+	}
+	return writeDataFile(path, choices)
+}
+
+// isModGroupEnabled 必选分组始终启用，可选分组没有选择过时使用默认值
+func isModGroupEnabled(group *ModGroup, choices ModChoices) bool {
+	switch group.Mode {
+	case ModGroupModeOptionalOn, ModGroupModeOptionalOff:
+		enabled, ok := choices[group.Id]
+		if ok {
+			return enabled
+		}
+		return group.Mode == ModGroupModeOptionalOn
+	default:
+		return true
+	}
+}
+
+func isOptionalModGroup(group *ModGroup) bool {
+	return group.Mode == ModGroupModeOptionalOn || group.Mode == ModGroupModeOptionalOff
+}
+
+// selectServerFiles 过滤掉未启用的可选MOD分组的文件
+// 同时属于多个分组的文件只要有一个分组启用就保留，不属于任何分组的文件视为必选
+func selectServerFiles(files []*FileInfo, groups []*ModGroup, choices ModChoices) []*FileInfo {
+	if len(groups) == 0 {
+		return files
+	}
+
+	selectedFiles := make([]*FileInfo, 0, len(files))
+	for _, file := range files {
+		isInGroup := false
+		isEnabled := false
+		for _, group := range groups {
+			if !isInModGroup(file.RelativePath, group) {
+				continue
+			}
+			isInGroup = true
+			if isModGroupEnabled(group, choices) {
+				isEnabled = true
+				break
+			}
+		}
+		if isInGroup && !isEnabled {
+			log.Debugf("[SKIP]optional mod disabled, file: %s\n", file.RelativePath)
+			continue
+		}
+		selectedFiles = append(selectedFiles, file)
+	}
+	return selectedFiles
+}
+
+func isInModGroup(relativePath string, group *ModGroup) bool {
+	p := normalizeRelativePath(relativePath)
+	for _, groupPath := range group.Paths {
+		gp := strings.TrimSuffix(normalizeRelativePath(groupPath), "/")
+		if gp == "" {
+			continue
+		}
+		if p == gp || strings.HasPrefix(p, gp+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeRelativePath(relativePath string) string {
+	return strings.ReplaceAll(relativePath, "\\", "/")
+}
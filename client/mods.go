@@ -0,0 +1,212 @@
+package client
+
+import (
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/comoyi/valheim-launcher/util/cryptoutil/md5util"
+	"github.com/comoyi/valheim-launcher/util/dotnetutil"
+	"github.com/comoyi/valheim-launcher/util/fsutil"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type ModSource int8
+
+const (
+	ModSourceServer   ModSource = 1
+	ModSourceUser     ModSource = 2
+	ModSourceModified ModSource = 3
+)
+
+func (s ModSource) String() string {
+	switch s {
+	case ModSourceServer:
+		return "服务器"
+	case ModSourceUser:
+		return "玩家添加"
+	case ModSourceModified:
+		return "与服务器不一致"
+	}
+	return "未知"
+}
+
+// InstalledMod BepInEx/plugins下已安装的MOD
+type InstalledMod struct {
+	Name         string
+	Version      string
+	GUID         string
+	RelativePath string
+	Source       ModSource
+}
+
+// getInstalledMods 扫描BepInEx/plugins，有manifest.json（Thunderstore包）的文件夹作为一个MOD，其他的每个dll作为一个MOD
+func getInstalledMods(baseDir string) ([]*InstalledMod, error) {
+	pluginsDir := filepath.Join(baseDir, "BepInEx", "plugins")
+	exists, err := fsutil.Exists(pluginsDir)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return make([]*InstalledMod, 0), nil
+	}
+
+	syncRecord, err := getSyncRecord(baseDir)
+	if err != nil {
+		log.Warnf("get sync record failed, err: %v\n", err)
+	}
+	recordFiles := getSyncRecordFileMap(syncRecord)
+
+	entries, err := os.ReadDir(pluginsDir)
+	if err != nil {
+		return nil, err
+	}
+	mods := make([]*InstalledMod, 0)
+	for _, entry := range entries {
+		path := filepath.Join(pluginsDir, entry.Name())
+		if !entry.IsDir() {
+			if isDllFile(path) {
+				mods = append(mods, newInstalledModFromDll(baseDir, path, recordFiles))
+			}
+			continue
+		}
+
+		manifestPath := filepath.Join(path, "manifest.json")
+		manifest, err := readThunderstoreManifest(manifestPath)
+		if err == nil {
+			mods = append(mods, newInstalledModFromPackage(baseDir, path, manifest, recordFiles))
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && isDllFile(p) {
+				mods = append(mods, newInstalledModFromDll(baseDir, p, recordFiles))
+			}
+			return nil
+		})
+		if err != nil {
+			log.Warnf("scan plugin dir failed, path: %s, err: %v\n", path, err)
+		}
+	}
+
+	sort.Slice(mods, func(i, j int) bool {
+		return strings.ToLower(mods[i].Name) < strings.ToLower(mods[j].Name)
+	})
+	return mods, nil
+}
+
+func newInstalledModFromDll(baseDir string, path string, recordFiles map[string]*FileInfo) *InstalledMod {
+	relativePath, _ := filepath.Rel(baseDir, path)
+	mod := &InstalledMod{
+		Name:         strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		RelativePath: relativePath,
+		Source:       getModSource(baseDir, []string{relativePath}, relativePath, recordFiles),
+	}
+	assemblyInfo, err := readAssemblyInfo(path)
+	if err != nil {
+		log.Debugf("read assembly info failed, path: %s, err: %v\n", path, err)
+		return mod
+	}
+	mod.Version = assemblyInfo.Version
+	if len(assemblyInfo.Plugins) > 0 {
+		plugin := assemblyInfo.Plugins[0]
+		mod.Name = plugin.Name
+		mod.Version = plugin.Version
+		mod.GUID = plugin.GUID
+	} else if assemblyInfo.Name != "" {
+		mod.Name = assemblyInfo.Name
+	}
+	return mod
+}
+
+func newInstalledModFromPackage(baseDir string, path string, manifest *ThunderstoreManifest, recordFiles map[string]*FileInfo) *InstalledMod {
+	relativePath, _ := filepath.Rel(baseDir, path)
+	mod := &InstalledMod{
+		Name:         manifest.Name,
+		Version:      manifest.VersionNumber,
+		RelativePath: relativePath,
+	}
+
+	relativePaths := make([]string, 0)
+	guids := make([]string, 0)
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rp, err := filepath.Rel(baseDir, p)
+		if err != nil {
+			return err
+		}
+		relativePaths = append(relativePaths, rp)
+		if isDllFile(p) {
+			assemblyInfo, err := readAssemblyInfo(p)
+			if err == nil {
+				for _, plugin := range assemblyInfo.Plugins {
+					guids = append(guids, plugin.GUID)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Warnf("scan plugin package failed, path: %s, err: %v\n", path, err)
+	}
+	mod.GUID = strings.Join(guids, ", ")
+	mod.Source = getModSource(baseDir, relativePaths, relativePath, recordFiles)
+	return mod
+}
+
+// getModSource 根据同步记录判断MOD的来源，modRelativePath下同步记录中的文件本地缺失或被修改时视为不一致
+func getModSource(baseDir string, relativePaths []string, modRelativePath string, recordFiles map[string]*FileInfo) ModSource {
+	managedCount := 0
+	isModified := false
+	for _, relativePath := range relativePaths {
+		recordFile, ok := recordFiles[normalizeRelativePath(relativePath)]
+		if !ok {
+			continue
+		}
+		managedCount++
+		hashSum, err := md5util.SumFile(filepath.Join(baseDir, relativePath))
+		if err != nil || hashSum != recordFile.Hash {
+			isModified = true
+		}
+	}
+	if managedCount == 0 {
+		return ModSourceUser
+	}
+	if isModified || managedCount < len(relativePaths) {
+		return ModSourceModified
+	}
+
+	modPath := normalizeRelativePath(modRelativePath)
+	for recordPath, recordFile := range recordFiles {
+		if recordFile.Type != TypeFile || !strings.HasPrefix(recordPath, modPath+"/") {
+			continue
+		}
+		exists, err := fsutil.LExists(filepath.Join(baseDir, recordFile.RelativePath))
+		if err != nil || !exists {
+			return ModSourceModified
+		}
+	}
+	return ModSourceServer
+}
+
+func readAssemblyInfo(path string) (*dotnetutil.AssemblyInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return dotnetutil.ReadAssemblyInfo(f)
+}
+
+func isDllFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".dll")
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+	"github.com/comoyi/valheim-launcher/config"
+	"github.com/comoyi/valheim-launcher/log"
+	"time"
+)
+
+// 桌面通知及系统托盘
+// 公告变化或服务器有新版本MOD包时发送桌面通知，可通过托盘菜单中的更新MOD直接更新
+// Fyne的桌面通知不支持按钮及点击回调，因此在通知内容中提示使用托盘菜单
+
+// 服务器不支持推送时检查新版本的间隔
+const serverRevisionPollInterval = 10 * time.Minute
+
+const notifyUpdateTip = "点击托盘菜单中的「更新MOD」立即更新"
+
+func sendNotification(title string, content string) {
+	if !config.Conf.IsNotify {
+		return
+	}
+	myApp.SendNotification(fyne.NewNotification(title, content))
+}
+
+func notifyNewRevision(revision int64) {
+	sendNotification("MOD包有新版本", fmt.Sprintf("MOD包已更新到版本%d，%s", revision, notifyUpdateTip))
+}
+
+// notifyAnnouncement 公告hash变化时通知，prevHash为空（首次获取）时不通知
+func notifyAnnouncement(prevHash string, announcement *Announcement) {
+	if prevHash == "" || announcement.Hash == "" || prevHash == announcement.Hash || !hasAnnouncement(announcement) {
+		return
+	}
+	content := announcement.Content
+	items := getVisibleAnnouncementItems(announcement, nil, time.Now().Unix())
+	if len(items) > 0 {
+		content = items[0].Title
+		if content == "" {
+			content = items[0].Content
+		}
+	}
+	if len([]rune(content)) > 100 {
+		content = string([]rune(content)[:100]) + "..."
+	}
+	sendNotification("新公告", content)
+}
+
+// initTray 支持系统托盘时显示托盘菜单，开启关闭到托盘时关闭窗口只隐藏
+func initTray() {
+	desk, ok := myApp.(desktop.App)
+	if !ok {
+		return
+	}
+	showMenuItem := fyne.NewMenuItem("显示窗口", func() {
+		w.Show()
+		w.RequestFocus()
+	})
+	updateMenuItem := fyne.NewMenuItem("更新MOD", func() {
+		w.Show()
+		w.RequestFocus()
+		requestUpdate()
+	})
+	desk.SetSystemTrayMenu(fyne.NewMenu(appName, showMenuItem, updateMenuItem))
+	if config.Conf.IsCloseToTray {
+		w.SetCloseIntercept(func() {
+			w.Hide()
+		})
+	}
+}
+
+// pollServerRevision 服务器不支持推送时定时获取文件列表，版本比上次同步的版本新时通知
+func pollServerRevision(ctx context.Context) {
+	var notifiedRevision int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(serverRevisionPollInterval):
+		}
+		if config.Conf.PinnedRevision > 0 {
+			continue
+		}
+		serverFileInfo, err := getServerFileInfo()
+		if err != nil {
+			log.Debugf("get server file info failed, err: %v\n", err)
+			continue
+		}
+		revision := serverFileInfo.Revision
+		if serverFileInfo.ScanStatus != ScanStatusCompleted || revision <= notifiedRevision || revision <= getSyncedRevision() {
+			continue
+		}
+		addMsgWithTime(fmt.Sprintf("MOD包有新版本（版本：%d），请更新MOD", revision))
+		notifyNewRevision(revision)
+		notifiedRevision = revision
+	}
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/comoyi/valheim-launcher/config"
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/comoyi/valheim-launcher/util/fsutil"
+	"github.com/comoyi/valheim-launcher/util/rateutil"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 后台预下载
+// 定时获取文件列表，将缓存中没有的文件下载到缓存，游戏运行时也可以进行，更新时直接从缓存复制
+
+var prefetchLimiter = rateutil.NewLimiter(0)
+
+func startPrefetch(ctx context.Context) {
+	prefetchLimiter.SetLimit(config.Conf.PrefetchRateLimit * 1024)
+	go func() {
+		for {
+			var count int
+			var err error
+			if isInQuietHours() {
+				log.Debugf("[SKIP]prefetch in quiet hours\n")
+			} else {
+				count, err = prefetch(ctx)
+			}
+			if err != nil {
+				log.Debugf("prefetch failed, err: %v\n", err)
+			} else if count > 0 {
+				addMsgWithTime(fmt.Sprintf("后台预下载完成，已下载%d个文件到缓存", count))
+			}
+
+			interval := config.Conf.PrefetchInterval
+			if interval <= 0 {
+				interval = 600
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Duration(interval) * time.Second):
+			}
+		}
+	}()
+}
+
+// prefetch 下载缓存中缺少的文件，返回下载的文件数量
+func prefetch(ctx context.Context) (int, error) {
+	if !config.Conf.IsUseCache {
+		return 0, fmt.Errorf("prefetch requires cache")
+	}
+	err := checkDownloadServers()
+	if err != nil {
+		return 0, err
+	}
+
+	serverFileInfo, err := getServerFileInfo()
+	if err != nil {
+		return 0, err
+	}
+	if serverFileInfo.ScanStatus != ScanStatusCompleted {
+		return 0, errServerScanning
+	}
+	if len(serverFileInfo.ModGroups) > 0 {
+		modChoices, err := getModChoices()
+		if err != nil {
+			log.Warnf("get mod choices failed, use default, err: %v\n", err)
+		}
+		serverFileInfo.Files = selectServerFiles(serverFileInfo.Files, serverFileInfo.ModGroups, modChoices)
+	}
+
+	files, err := getPrefetchFiles(serverFileInfo.Files)
+	if err != nil {
+		return 0, err
+	}
+	log.Debugf("prefetch file count: %d\n", len(files))
+
+	source := newServerSource()
+	count := 0
+	for _, file := range files {
+		select {
+		case <-ctx.Done():
+			return count, ctx.Err()
+		default:
+		}
+		if isInQuietHours() {
+			log.Debugf("prefetch paused, in quiet hours\n")
+			break
+		}
+		err = prefetchFile(ctx, file, source)
+		if err != nil {
+			log.Debugf("prefetch file failed, file: %s, err: %v\n", file.RelativePath, err)
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// getPrefetchFiles 需要预下载的文件，已在缓存中或上次同步后游戏文件夹中已有的文件不需要下载，相同hash的文件只下载一次
+func getPrefetchFiles(serverFiles []*FileInfo) ([]*FileInfo, error) {
+	cacheInfo, err := getCacheInfo()
+	if err != nil {
+		return nil, err
+	}
+	cacheDirPath, err := getCacheDirPath()
+	if err != nil {
+		return nil, err
+	}
+
+	syncedHashes := make(map[string]bool)
+	baseDir := config.Conf.Dir
+	if baseDir != "" {
+		baseDir = filepath.Clean(baseDir)
+		syncRecord, err := getSyncRecord(baseDir)
+		if err != nil {
+			log.Warnf("get sync record failed, err: %v\n", err)
+		}
+		recordFiles := getSyncRecordFileMap(syncRecord)
+		for _, recordFile := range recordFiles {
+			if recordFile.Type != TypeFile || recordFile.Hash == "" {
+				continue
+			}
+			exists, err := fsutil.LExists(filepath.Join(baseDir, recordFile.RelativePath))
+			if err == nil && exists {
+				syncedHashes[recordFile.Hash] = true
+			}
+		}
+	}
+
+	files := make([]*FileInfo, 0)
+	hashes := make(map[string]bool)
+	for _, file := range serverFiles {
+		if file.Type != TypeFile || file.Hash == "" || hashes[file.Hash] || syncedHashes[file.Hash] {
+			continue
+		}
+		hashes[file.Hash] = true
+		isHit, cacheFile := checkHitCache(file.Hash, cacheInfo)
+		if isHit && cacheFile != nil {
+			exists, err := fsutil.LExists(filepath.Join(cacheDirPath, cacheFile.RelativePath))
+			if err == nil && exists {
+				continue
+			}
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// prefetchFile 下载文件到缓存，hash校验通过后写入缓存数据库
+func prefetchFile(ctx context.Context, file *FileInfo, source fileSource) error {
+	srcFile, err := source.openFile(file)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	h := md5.New()
+	reader := io.TeeReader(rateutil.NewReader(ctx, srcFile, prefetchLimiter), h)
+	cacheFile, err := writeCacheFile(reader, file.Hash, TypeFile)
+	if err != nil {
+		return err
+	}
+	hashSum := hex.EncodeToString(h.Sum(nil))
+	if hashSum != file.Hash {
+		cacheDirPath, err := getCacheDirPath()
+		if err == nil {
+			_ = os.Remove(filepath.Join(cacheDirPath, cacheFile.RelativePath))
+		}
+		return fmt.Errorf("download file hash check failed, expected: %s, got: %s", file.Hash, hashSum)
+	}
+
+	_, err = addCacheDbData(file.Hash, cacheFile)
+	if err != nil {
+		return err
+	}
+	log.Debugf("[PREFETCH]file: %s, hash: %s\n", file.RelativePath, file.Hash)
+	return nil
+}
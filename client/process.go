@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/comoyi/valheim-launcher/log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+var errGameRunning = fmt.Errorf("英灵神殿正在运行，请先关闭英灵神殿再更新")
+
+var gameProcessNames = []string{
+	"valheim.exe",
+	"valheim.x86_64",
+}
+
+// isGameRunning 检查是否有运行中的游戏进程来自baseDir
+func isGameRunning(baseDir string) (bool, error) {
+	paths, err := getGameProcessPaths()
+	if err != nil {
+		return false, err
+	}
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		log.Debugf("found game process, path: %s\n", path)
+		isBelong, err := isBelongDir(path, baseDir)
+		if err != nil {
+			return false, err
+		}
+		if isBelong {
+			return true, nil
+		}
+		if runtime.GOOS == "windows" {
+			// Windows路径不区分大小写
+			isBelong, err = isBelongDir(strings.ToLower(path), strings.ToLower(baseDir))
+			if err != nil {
+				return false, err
+			}
+			if isBelong {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// waitGameExit 等待来自baseDir的游戏进程全部退出
+func waitGameExit(ctx context.Context, baseDir string) error {
+	for {
+		isRunning, err := isGameRunning(baseDir)
+		if err != nil {
+			return err
+		}
+		if !isRunning {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// watchLaunchedGame 等待启动的游戏进程出现，然后等待其退出
+func watchLaunchedGame(ctx context.Context, baseDir string) {
+	isStarted := false
+	for i := 0; i < 60; i++ {
+		isRunning, err := isGameRunning(baseDir)
+		if err != nil {
+			log.Debugf("check game process failed, err: %v\n", err)
+			return
+		}
+		if isRunning {
+			isStarted = true
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(2 * time.Second):
+		}
+	}
+	if !isStarted {
+		log.Debugf("game process not found after launch, baseDir: %s\n", baseDir)
+		return
+	}
+	addMsgWithTime("英灵神殿已启动")
+
+	err := waitGameExit(ctx, baseDir)
+	if err != nil {
+		log.Debugf("wait game exit failed, err: %v\n", err)
+		return
+	}
+	addMsgWithTime("英灵神殿已退出")
+}
+
+func getGameProcessPaths() ([]string, error) {
+	if runtime.GOOS == "windows" {
+		return getWindowsGameProcessPaths()
+	}
+	return getProcGameProcessPaths()
+}
+
+func getWindowsGameProcessPaths() ([]string, error) {
+	names := make([]string, 0, len(gameProcessNames))
+	for _, name := range gameProcessNames {
+		names = append(names, strings.TrimSuffix(name, filepath.Ext(name)))
+	}
+	script := fmt.Sprintf("Get-Process -Name %s -ErrorAction SilentlyContinue | ForEach-Object { $_.Path }", strings.Join(names, ","))
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+	out, err := cmd.Output()
+	if err != nil {
+		log.Debugf("get process list failed, err: %v\n", err)
+		return nil, err
+	}
+	paths := make([]string, 0)
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths, nil
+}
+
+// getProcGameProcessPaths 从/proc中查找游戏进程（Linux，包括Proton/Wine运行的valheim.exe）
+func getProcGameProcessPaths() ([]string, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	paths := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.Trim(entry.Name(), "0123456789") != "" {
+			continue
+		}
+		procDir := filepath.Join("/proc", entry.Name())
+
+		exe, err := os.Readlink(filepath.Join(procDir, "exe"))
+		if err == nil && isGameProcessName(exe) {
+			paths = append(paths, exe)
+			continue
+		}
+
+		cmdline, err := os.ReadFile(filepath.Join(procDir, "cmdline"))
+		if err != nil {
+			continue
+		}
+		for _, arg := range strings.Split(string(cmdline), "\x00") {
+			if isGameProcessName(strings.ReplaceAll(arg, "\\", "/")) {
+				paths = append(paths, arg)
+				break
+			}
+		}
+	}
+	return paths, nil
+}
+
+func isGameProcessName(path string) bool {
+	name := strings.ToLower(filepath.Base(path))
+	for _, gameProcessName := range gameProcessNames {
+		if name == gameProcessName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,295 @@
+package client
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/comoyi/valheim-launcher/util/fsutil"
+	"github.com/comoyi/valheim-launcher/util/ziputil"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// r2modman / Thunderstore Mod Manager 的配置导出文件（.r2z）
+// zip中包含描述MOD列表的export.r2x（YAML）以及BepInEx文件夹
+
+const r2xFileName = "export.r2x"
+
+type R2Profile struct {
+	ProfileName string
+	Mods        []*R2Mod
+}
+
+type R2Mod struct {
+	Name    string
+	Major   int
+	Minor   int
+	Patch   int
+	Enabled bool
+}
+
+func (m *R2Mod) Version() string {
+	return fmt.Sprintf("%d.%d.%d", m.Major, m.Minor, m.Patch)
+}
+
+// 导出时忽略的文件
+var r2zIgnoreFiles = []string{
+	"BepInEx/LogOutput.log",
+	"BepInEx/cache",
+}
+
+// exportR2Profile 导出游戏文件夹中的BepInEx为r2modman配置
+func exportR2Profile(baseDir string, profileName string, writer io.Writer) error {
+	bepInExDir := filepath.Join(baseDir, "BepInEx")
+	exists, err := fsutil.Exists(bepInExDir)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("BepInEx not found in %s", baseDir)
+	}
+
+	profile := &R2Profile{
+		ProfileName: profileName,
+		Mods:        getR2ProfileMods(baseDir),
+	}
+
+	zw := zip.NewWriter(writer)
+	w, err := zw.Create(r2xFileName)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, encodeR2x(profile))
+	if err != nil {
+		return err
+	}
+
+	err = filepath.Walk(bepInExDir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(baseDir, path)
+		if err != nil {
+			return err
+		}
+		if isR2zIgnoreFile(relativePath) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return ziputil.AddFile(zw, path, relativePath, info)
+	})
+	if err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+func isR2zIgnoreFile(relativePath string) bool {
+	p := normalizeRelativePath(relativePath)
+	for _, ignoreFile := range r2zIgnoreFiles {
+		if strings.EqualFold(p, ignoreFile) {
+			return true
+		}
+	}
+	return false
+}
+
+// getR2ProfileMods 以 作者-名称 命名且包含manifest.json的插件文件夹视为Thunderstore包
+func getR2ProfileMods(baseDir string) []*R2Mod {
+	mods := make([]*R2Mod, 0)
+	pluginsDir := filepath.Join(baseDir, "BepInEx", "plugins")
+	entries, err := os.ReadDir(pluginsDir)
+	if err != nil {
+		return mods
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.Contains(entry.Name(), "-") {
+			continue
+		}
+		manifest, err := readThunderstoreManifest(filepath.Join(pluginsDir, entry.Name(), "manifest.json"))
+		if err != nil {
+			continue
+		}
+		mod := &R2Mod{
+			Name:    entry.Name(),
+			Enabled: true,
+		}
+		parts := strings.SplitN(manifest.VersionNumber, ".", 3)
+		for i, part := range parts {
+			n, _ := strconv.Atoi(part)
+			switch i {
+			case 0:
+				mod.Major = n
+			case 1:
+				mod.Minor = n
+			case 2:
+				mod.Patch = n
+			}
+		}
+		mods = append(mods, mod)
+	}
+	sort.Slice(mods, func(i, j int) bool {
+		return mods[i].Name < mods[j].Name
+	})
+	return mods
+}
+
+func encodeR2x(profile *R2Profile) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("profileName: %s\n", strconv.Quote(profile.ProfileName)))
+	if len(profile.Mods) == 0 {
+		b.WriteString("mods: []\n")
+		return b.String()
+	}
+	b.WriteString("mods:\n")
+	for _, mod := range profile.Mods {
+		b.WriteString(fmt.Sprintf("  - name: %s\n", mod.Name))
+		b.WriteString("    version:\n")
+		b.WriteString(fmt.Sprintf("      major: %d\n", mod.Major))
+		b.WriteString(fmt.Sprintf("      minor: %d\n", mod.Minor))
+		b.WriteString(fmt.Sprintf("      patch: %d\n", mod.Patch))
+		b.WriteString(fmt.Sprintf("    enabled: %t\n", mod.Enabled))
+	}
+	return b.String()
+}
+
+// decodeR2x 只解析export.r2x中用到的字段
+func decodeR2x(r io.Reader) (*R2Profile, error) {
+	profile := &R2Profile{
+		Mods: make([]*R2Mod, 0),
+	}
+	var mod *R2Mod
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		isNewItem := strings.HasPrefix(line, "- ")
+		line = strings.TrimPrefix(line, "- ")
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.TrimSpace(line[:i])
+		value := strings.Trim(strings.TrimSpace(line[i+1:]), `"'`)
+		if isNewItem {
+			mod = &R2Mod{Enabled: true}
+			profile.Mods = append(profile.Mods, mod)
+		}
+		if key == "profileName" {
+			profile.ProfileName = value
+			continue
+		}
+		if mod == nil {
+			continue
+		}
+		switch key {
+		case "name":
+			mod.Name = value
+		case "major":
+			mod.Major, _ = strconv.Atoi(value)
+		case "minor":
+			mod.Minor, _ = strconv.Atoi(value)
+		case "patch":
+			mod.Patch, _ = strconv.Atoi(value)
+		case "enabled":
+			mod.Enabled = value != "false"
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// importR2Profile 导入r2modman配置，只导入BepInEx文件夹下的文件，返回配置中缺少文件的MOD
+func importR2Profile(baseDir string, r2zPath string) (*R2Profile, []*R2Mod, error) {
+	zr, err := zip.OpenReader(r2zPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer zr.Close()
+
+	var profile *R2Profile
+	localPaths := make(map[*zip.File]string)
+	for _, f := range zr.File {
+		name := normalizeZipEntryName(f.Name)
+		if name == r2xFileName {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, nil, err
+			}
+			profile, err = decodeR2x(rc)
+			rc.Close()
+			if err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if f.FileInfo().IsDir() || !f.Mode().IsRegular() {
+			continue
+		}
+		if !strings.HasPrefix(strings.ToLower(name), "bepinex/") {
+			log.Debugf("[SKIP]not in BepInEx, entry: %s\n", f.Name)
+			continue
+		}
+		localPath, err := ziputil.SafeJoin(baseDir, name)
+		if err != nil {
+			log.Warnf("illegal path in r2modman profile, entry: %s\n", f.Name)
+			return nil, nil, err
+		}
+		localPaths[f] = localPath
+	}
+	if profile == nil {
+		return nil, nil, fmt.Errorf("%s not found in %s", r2xFileName, r2zPath)
+	}
+
+	importRecord, err := getImportRecord(baseDir)
+	if err != nil {
+		log.Warnf("get import record failed, err: %v\n", err)
+	}
+	importedFiles := make([]string, 0, len(localPaths))
+	for _, f := range zr.File {
+		localPath, ok := localPaths[f]
+		if !ok {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		err = writeLocalFile(localPath, baseDir, rc)
+		rc.Close()
+		if err != nil {
+			addImportedFiles(baseDir, importRecord, getR2ProfileImportId(profile), "", importedFiles)
+			return nil, nil, err
+		}
+		relativePath, _ := filepath.Rel(baseDir, localPath)
+		importedFiles = append(importedFiles, relativePath)
+		log.Debugf("[IMPORT]r2modman profile, localPath: %s\n", localPath)
+	}
+	addImportedFiles(baseDir, importRecord, getR2ProfileImportId(profile), "", importedFiles)
+
+	missingMods := make([]*R2Mod, 0)
+	for _, mod := range profile.Mods {
+		if mod.Name == "" || strings.HasPrefix(mod.Name, "denikson-BepInExPack") {
+			continue
+		}
+		exists, err := fsutil.Exists(filepath.Join(baseDir, "BepInEx", "plugins", mod.Name))
+		if err != nil || !exists {
+			missingMods = append(missingMods, mod)
+		}
+	}
+	return profile, missingMods, nil
+}
+
+func getR2ProfileImportId(profile *R2Profile) string {
+	return fmt.Sprintf("r2modman-profile-%s", profile.ProfileName)
+}
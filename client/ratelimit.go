@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"github.com/comoyi/valheim-launcher/config"
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/comoyi/valheim-launcher/util/rateutil"
+	"github.com/comoyi/valheim-launcher/util/timeutil"
+	"io"
+	"time"
+)
+
+// downloadLimiter 全局下载限速，所有从服务器下载的文件共享，局域网内的下载不限速
+var downloadLimiter = rateutil.NewLimiter(0)
+
+// 界面上可选的限速 （单位：KB/s） 0代表不限速
+var downloadRateLimitOptions = []int64{0, 256, 512, 1024, 2048, 5120, 10240}
+
+func initDownloadRateLimit() {
+	downloadLimiter.SetLimit(config.Conf.DownloadRateLimit * 1024)
+}
+
+// setDownloadRateLimit 修改全局下载限速 （单位：KB/s），正在进行的下载立即生效
+func setDownloadRateLimit(limit int64) {
+	config.Conf.DownloadRateLimit = limit
+	downloadLimiter.SetLimit(limit * 1024)
+	log.Debugf("set download rate limit: %d KB/s\n", limit)
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func newLimitedReadCloser(rc io.ReadCloser) io.ReadCloser {
+	return &limitedReadCloser{
+		Reader: rateutil.NewReader(context.Background(), rc, downloadLimiter),
+		Closer: rc,
+	}
+}
+
+// isInQuietHours 是否处于免打扰时段，免打扰时段内不进行后台预下载
+func isInQuietHours() bool {
+	quietHours := config.Conf.QuietHours
+	if quietHours == "" {
+		return false
+	}
+	isIn, err := timeutil.IsInDailyRange(time.Now(), quietHours)
+	if err != nil {
+		log.Warnf("invalid quiet hours, quietHours: %s, err: %v\n", quietHours, err)
+		return false
+	}
+	return isIn
+}
@@ -0,0 +1,231 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/comoyi/valheim-launcher/util/cryptoutil/ed25519util"
+	"github.com/comoyi/valheim-launcher/util/versionutil"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 启动器自动更新
+// 下载新版本到<启动器>.new，校验hash及签名后将当前启动器重命名为<启动器>.old，新版本重命名为启动器，然后启动新版本
+// 新版本启动后在标记文件中确认，旧版本等到确认后退出，新版本退出或超时未确认时恢复旧版本
+// 确认后的下次启动删除<启动器>.old
+
+// 等待新版本确认启动的时间
+const selfUpdateConfirmTimeout = 30 * time.Second
+
+var errSelfUpdateNotConfirmed = fmt.Errorf("新版本启动器启动失败，已恢复旧版本")
+
+// SelfUpdateMarker 自动更新标记，Path为启动器路径
+type SelfUpdateMarker struct {
+	Version     string `json:"version"`
+	Path        string `json:"path"`
+	IsConfirmed bool   `json:"is_confirmed"`
+}
+
+func getSelfUpdateMarkerPath() (string, error) {
+	dataDirPath, err := getDataDirPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDirPath, "self-update.json"), nil
+}
+
+// getSelfUpdateMarker 没有标记时返回nil
+func getSelfUpdateMarker() (*SelfUpdateMarker, error) {
+	path, err := getSelfUpdateMarkerPath()
+	if err != nil {
+		return nil, err
+	}
+	var marker *SelfUpdateMarker
+	isExist, err := readDataFile(path, &marker)
+	if err != nil || !isExist {
+		return nil, err
+	}
+	return marker, nil
+}
+
+func saveSelfUpdateMarker(marker *SelfUpdateMarker) error {
+	path, err := getSelfUpdateMarkerPath()
+	if err != nil {
+		return err
+	}
+	return writeDataFile(path, marker)
+}
+
+func removeSelfUpdateMarker() {
+	path, err := getSelfUpdateMarkerPath()
+	if err != nil {
+		return
+	}
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf("remove self update marker failed, err: %v\n", err)
+	}
+}
+
+func getExecutablePath() (string, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exePath)
+}
+
+// downloadNewVersion 下载新版本到exePath.new，校验hash及签名，返回下载的文件路径
+func downloadNewVersion(v *Version, exePath string) (string, error) {
+	resp, err := http.Get(v.Url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+	hashSum := hex.EncodeToString(sum[:])
+	if !strings.EqualFold(hashSum, v.Hash) {
+		return "", fmt.Errorf("new version hash check failed, expected: %s, got: %s", v.Hash, hashSum)
+	}
+	err = ed25519util.Verify(releasePublicKey, content, v.Signature)
+	if err != nil {
+		log.Warnf("verify new version signature failed, err: %v\n", err)
+		return "", err
+	}
+
+	newPath := exePath + ".new"
+	err = os.WriteFile(newPath, content, 0o755)
+	if err != nil {
+		return "", err
+	}
+	return newPath, nil
+}
+
+// selfUpdate 替换启动器并启动新版本，新版本确认启动后返回nil，由调用方退出当前程序
+func selfUpdate(v *Version) error {
+	exePath, err := getExecutablePath()
+	if err != nil {
+		return err
+	}
+	newPath, err := downloadNewVersion(v, exePath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(newPath)
+
+	oldPath := exePath + ".old"
+	_ = os.Remove(oldPath)
+	err = os.Rename(exePath, oldPath)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(newPath, exePath)
+	if err != nil {
+		_ = os.Rename(oldPath, exePath)
+		return err
+	}
+	err = saveSelfUpdateMarker(&SelfUpdateMarker{
+		Version: v.Version,
+		Path:    exePath,
+	})
+	if err != nil {
+		rollbackSelfUpdate(exePath)
+		return err
+	}
+
+	cmd := exec.Command(exePath, os.Args[1:]...)
+	err = cmd.Start()
+	if err != nil {
+		log.Warnf("start new version failed, err: %v\n", err)
+		rollbackSelfUpdate(exePath)
+		return errSelfUpdateNotConfirmed
+	}
+	err = waitSelfUpdateConfirmed(cmd)
+	if err != nil {
+		log.Warnf("new version not confirmed, err: %v\n", err)
+		rollbackSelfUpdate(exePath)
+		return errSelfUpdateNotConfirmed
+	}
+	log.Debugf("self update confirmed, version: %s\n", v.Version)
+	return nil
+}
+
+// waitSelfUpdateConfirmed 等待新版本确认启动，超时未确认时结束新版本进程
+func waitSelfUpdateConfirmed(cmd *exec.Cmd) error {
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	timeout := time.After(selfUpdateConfirmTimeout)
+	for {
+		select {
+		case err := <-exited:
+			return fmt.Errorf("new version exited, err: %v", err)
+		case <-timeout:
+			_ = cmd.Process.Kill()
+			<-exited
+			return fmt.Errorf("wait confirm timeout")
+		case <-time.After(500 * time.Millisecond):
+			marker, err := getSelfUpdateMarker()
+			if err == nil && marker != nil && marker.IsConfirmed {
+				return nil
+			}
+		}
+	}
+}
+
+// rollbackSelfUpdate 用exePath.old恢复旧版本
+func rollbackSelfUpdate(exePath string) {
+	removeSelfUpdateMarker()
+	_ = os.Remove(exePath)
+	err := os.Rename(exePath+".old", exePath)
+	if err != nil {
+		log.Warnf("rollback self update failed, err: %v\n", err)
+	}
+}
+
+// finishSelfUpdate 启动时调用，新版本启动完成后确认更新，已确认时删除旧版本
+func finishSelfUpdate() {
+	marker, err := getSelfUpdateMarker()
+	if err != nil || marker == nil {
+		return
+	}
+	if marker.IsConfirmed {
+		err = os.Remove(marker.Path + ".old")
+		if err != nil && !os.IsNotExist(err) {
+			log.Debugf("remove old version failed, err: %v\n", err)
+			return
+		}
+		removeSelfUpdateMarker()
+		return
+	}
+	if versionutil.Compare(marker.Version, versionText) != 0 {
+		log.Debugf("stale self update marker, version: %s\n", marker.Version)
+		removeSelfUpdateMarker()
+		return
+	}
+	myApp.Lifecycle().SetOnStarted(func() {
+		marker.IsConfirmed = true
+		err := saveSelfUpdateMarker(marker)
+		if err != nil {
+			log.Warnf("confirm self update failed, err: %v\n", err)
+			return
+		}
+		addMsgWithTime(fmt.Sprintf("启动器已更新到%s", versionText))
+	})
+}
@@ -0,0 +1,190 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/comoyi/valheim-launcher/config"
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/comoyi/valheim-launcher/util/versionutil"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// 协议版本协商
+// 更新前通过 /info 获取服务器支持的协议版本及功能，根据服务器支持的功能决定是否使用压缩、增量同步、服务器推送等
+// 服务器没有 /info 时（旧版服务器）视为协议版本0，不知道服务器支持哪些功能，各功能仍按原来的方式逐个探测
+
+// 启动器实现的协议版本
+const protocolVersion = 1
+
+// 没有 /info 的旧版服务器的协议版本
+const legacyProtocolVersion = 0
+
+// 启动器支持的最低服务器协议版本（提供 /info 的服务器），旧版服务器单独处理
+const minServerProtocolVersion = 1
+
+// 启动器支持的hash算法
+const hashAlgorithmMd5 = "md5"
+
+var errLauncherTooOld = fmt.Errorf("启动器版本过旧，请更新启动器")
+var errServerTooOld = fmt.Errorf("服务器版本过旧，请联系服主更新服务器")
+var errSignatureNotSupported = fmt.Errorf("服务器不支持文件列表签名，请检查配置中的manifest_public_key")
+
+// ServerInfo 服务器信息
+// MinProtocolVersion 服务器支持的最低启动器协议版本
+// MinLauncherVersion 服务器要求的最低启动器版本，为空时不限制
+// Channels 服务器提供的发布通道，不包含默认通道
+type ServerInfo struct {
+	ProtocolVersion      int      `json:"protocol_version"`
+	MinProtocolVersion   int      `json:"min_protocol_version"`
+	HashAlgorithms       []string `json:"hash_algorithms"`
+	Compressions         []string `json:"compressions"`
+	IsDeltaSupported     bool     `json:"delta"`
+	IsSignatureSupported bool     `json:"signature"`
+	IsEventsSupported    bool     `json:"events"`
+	MinLauncherVersion   string   `json:"min_launcher_version"`
+	Channels             []string `json:"channels"`
+	// IsLegacy 服务器没有 /info
+	IsLegacy bool `json:"-"`
+}
+
+// legacyServerInfo 旧版服务器，只使用md5，其他功能开启的前提是不支持时能够安全地回退：
+// 压缩根据响应的Content-Encoding处理，增量同步不支持Range时下载整个文件，推送不存在时定时获取，
+// 签名从响应头获取，没有签名时校验失败
+var legacyServerInfo = &ServerInfo{
+	ProtocolVersion:      legacyProtocolVersion,
+	HashAlgorithms:       []string{hashAlgorithmMd5},
+	Compressions:         []string{CompressionZstd, CompressionGzip},
+	IsDeltaSupported:     true,
+	IsSignatureSupported: true,
+	IsEventsSupported:    true,
+	IsLegacy:             true,
+}
+
+var serverInfo = legacyServerInfo
+var serverInfoMutex = &sync.Mutex{}
+
+// getServerInfo 最近一次握手获取到的服务器信息，还未握手时视为旧版服务器
+func getServerInfo() *ServerInfo {
+	serverInfoMutex.Lock()
+	defer serverInfoMutex.Unlock()
+	return serverInfo
+}
+
+// handshake 获取服务器信息并检查是否兼容，获取失败时沿用上次的服务器信息
+func handshake() (*ServerInfo, error) {
+	info, err := fetchServerInfo()
+	if err != nil {
+		log.Debugf("fetch server info failed, err: %v\n", err)
+		return getServerInfo(), nil
+	}
+	serverInfoMutex.Lock()
+	serverInfo = info
+	serverInfoMutex.Unlock()
+	log.Debugf("server info: %+v\n", info)
+	return info, checkServerInfo(info)
+}
+
+func fetchServerInfo() (*ServerInfo, error) {
+	resp, err := http.Get(getFullUrl("/info"))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return legacyServerInfo, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var info *ServerInfo
+	err = json.Unmarshal(content, &info)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, fmt.Errorf("server info is empty")
+	}
+	return info, nil
+}
+
+// checkServerInfo 检查协议版本、hash算法、签名及最低启动器版本
+func checkServerInfo(info *ServerInfo) error {
+	if info.MinProtocolVersion > protocolVersion {
+		log.Warnf("launcher protocol too old, protocol version: %d, server min protocol version: %d\n", protocolVersion, info.MinProtocolVersion)
+		return errLauncherTooOld
+	}
+	if info.IsLegacy {
+		log.Debugf("legacy server, protocol version: %d\n", info.ProtocolVersion)
+	} else if info.ProtocolVersion < minServerProtocolVersion {
+		log.Warnf("server protocol too old, server protocol version: %d, min server protocol version: %d\n", info.ProtocolVersion, minServerProtocolVersion)
+		return errServerTooOld
+	}
+	if len(info.HashAlgorithms) > 0 && !containsFold(info.HashAlgorithms, hashAlgorithmMd5) {
+		log.Warnf("hash algorithm not supported, server hash algorithms: %v\n", info.HashAlgorithms)
+		return errLauncherTooOld
+	}
+	if config.Conf.ManifestPublicKey != "" && !info.IsSignatureSupported {
+		return errSignatureNotSupported
+	}
+	return checkMinLauncherVersion(info.MinLauncherVersion)
+}
+
+// launcherVersionError 启动器版本低于服务器要求的最低版本
+type launcherVersionError struct {
+	minVersion string
+}
+
+func (e *launcherVersionError) Error() string {
+	return fmt.Sprintf("启动器版本过旧（当前版本：%s，最低要求版本：%s），请更新启动器", versionText, e.minVersion)
+}
+
+func (e *launcherVersionError) Unwrap() error {
+	return errLauncherTooOld
+}
+
+// checkMinLauncherVersion minVersion为空时不限制
+func checkMinLauncherVersion(minVersion string) error {
+	if minVersion == "" || versionutil.Compare(versionText, minVersion) >= 0 {
+		return nil
+	}
+	log.Warnf("launcher too old, version: %s, min launcher version: %s\n", versionText, minVersion)
+	return &launcherVersionError{
+		minVersion: minVersion,
+	}
+}
+
+func isIncompatibleErr(err error) bool {
+	return errors.Is(err, errLauncherTooOld) || errors.Is(err, errServerTooOld) || errors.Is(err, errSignatureNotSupported)
+}
+
+// getAcceptEncoding 请求/sync时的Accept-Encoding，只包含服务器支持的压缩格式
+func getAcceptEncoding() string {
+	compressions := getServerInfo().Compressions
+	accepts := make([]string, 0)
+	for _, compression := range []string{CompressionZstd, CompressionGzip} {
+		if containsFold(compressions, compression) {
+			accepts = append(accepts, compression)
+		}
+	}
+	if len(accepts) == 0 {
+		return "identity"
+	}
+	return strings.Join(accepts, ", ")
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+	"github.com/comoyi/valheim-launcher/config"
+	"github.com/comoyi/valheim-launcher/util/timeutil"
+	"strings"
+	"time"
+)
+
+const serverStatusQueryTimeout = 5 * time.Second
+
+func refreshServerStatus(w *widget.Label, box *fyne.Container, c *fyne.Container) {
+	address := config.Conf.GameServerAddress
+	if address == "" {
+		box.Hide()
+		c.Refresh()
+		return
+	}
+
+	serverStatus, err := queryServerStatus(address, serverStatusQueryTimeout)
+	if err != nil {
+		w.SetText(fmt.Sprintf("服务器：%s\n状态：离线或无法连接", address))
+		box.Show()
+		c.Refresh()
+		return
+	}
+
+	w.SetText(formatServerStatus(serverStatus))
+	box.Show()
+	c.Refresh()
+}
+
+func formatServerStatus(serverStatus *ServerStatus) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("服务器：%s\n", serverStatus.Name))
+	b.WriteString(fmt.Sprintf("状态：在线  延迟：%dms  版本：%s  地图：%s\n", serverStatus.Ping.Milliseconds(), serverStatus.Version, serverStatus.Map))
+	b.WriteString(fmt.Sprintf("玩家：%d / %d", serverStatus.Players, serverStatus.MaxPlayers))
+	if len(serverStatus.PlayerList) > 0 {
+		names := make([]string, 0, len(serverStatus.PlayerList))
+		for _, player := range serverStatus.PlayerList {
+			if player.Name == "" {
+				continue
+			}
+			names = append(names, fmt.Sprintf("%s（%s）", player.Name, timeutil.FormatDuration(int64(player.Duration.Seconds()))))
+		}
+		if len(names) > 0 {
+			b.WriteString("\n在线玩家：" + strings.Join(names, "、"))
+		}
+	}
+	return b.String()
+}
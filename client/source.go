@@ -0,0 +1,80 @@
+package client
+
+import (
+	"github.com/comoyi/valheim-launcher/log"
+	"io"
+	"net/http"
+)
+
+// fileSource 更新时文件列表和文件内容的来源
+type fileSource interface {
+	String() string
+	getServerManifest() (*ServerManifest, error)
+	openFile(fileInfo *FileInfo) (io.ReadCloser, error)
+	readLink(fileInfo *FileInfo) (string, error)
+	close() error
+}
+
+// serverSource 从服务器获取文件列表，从DownloadServer下载文件
+// 无法连接服务器时使用最近一次获取到的文件列表，offlineTime为该文件列表的获取时间
+type serverSource struct {
+	offlineTime int64
+}
+
+func newServerSource() *serverSource {
+	return &serverSource{}
+}
+
+func (s *serverSource) String() string {
+	return "服务器"
+}
+
+// getServerManifest 先握手，与服务器不兼容时不获取文件列表
+func (s *serverSource) getServerManifest() (*ServerManifest, error) {
+	_, err := handshake()
+	if err != nil {
+		return nil, err
+	}
+	s.offlineTime = 0
+	manifest, err := fetchServerManifest()
+	if err != nil {
+		offlineManifest, offlineTime := getOfflineManifest()
+		if offlineManifest == nil {
+			return nil, err
+		}
+		log.Warnf("fetch server manifest failed, use offline manifest, err: %v\n", err)
+		s.offlineTime = offlineTime
+		return offlineManifest, nil
+	}
+	return manifest, nil
+}
+
+func (s *serverSource) isOffline() bool {
+	return s.offlineTime > 0
+}
+
+// openFile 开启局域网共享时先从局域网节点获取
+func (s *serverSource) openFile(fileInfo *FileInfo) (io.ReadCloser, error) {
+	f, ok := openFileFromLanPeers(fileInfo)
+	if ok {
+		return f, nil
+	}
+	return downloadFile(fileInfo)
+}
+
+func (s *serverSource) readLink(fileInfo *FileInfo) (string, error) {
+	resp, err := http.Get(getFullDownloadUrlByFile(fileInfo.RelativePath))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	serverLinkDestByte, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(serverLinkDestByte), nil
+}
+
+func (s *serverSource) close() error {
+	return nil
+}
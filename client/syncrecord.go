@@ -0,0 +1,134 @@
+package client
+
+import (
+	"encoding/json"
+	"github.com/comoyi/valheim-launcher/config"
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/comoyi/valheim-launcher/util/cryptoutil/md5util"
+	"github.com/comoyi/valheim-launcher/util/timeutil"
+	"path/filepath"
+	"time"
+)
+
+// SyncRecord 某个游戏文件夹最近一次同步完成时从服务器同步的文件
+type SyncRecord struct {
+	Dir           string      `json:"dir"`
+	SyncTimestamp int64       `json:"sync_timestamp"`
+	SyncTime      string      `json:"sync_time"`
+	Files         []*FileInfo `json:"files"`
+	// Revision 同步时服务器文件列表的版本，服务器不支持时为0
+	Revision int64 `json:"revision"`
+	// Channel 同步时的发布通道
+	Channel string `json:"channel"`
+	// Manifest 同步时使用的完整文件列表（未按可选MOD过滤），用于导出离线更新包
+	Manifest *ServerManifest `json:"manifest"`
+}
+
+func getSyncRecordFilePath(baseDir string) (string, error) {
+	dirDataPath, err := getDirDataPath(baseDir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dirDataPath, "sync-record.json"), nil
+}
+
+// getSyncRecord 获取同步记录，从未同步过时返回nil
+func getSyncRecord(baseDir string) (*SyncRecord, error) {
+	path, err := getSyncRecordFilePath(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	var syncRecord *SyncRecord
+	isExist, err := readDataFile(path, &syncRecord)
+	if err != nil || !isExist {
+		return nil, err
+	}
+	return syncRecord, nil
+}
+
+func saveSyncRecord(baseDir string, files []*FileInfo, revision int64, manifest *ServerManifest) error {
+	path, err := getSyncRecordFilePath(baseDir)
+	if err != nil {
+		return err
+	}
+	nowTimestamp := time.Now().Unix()
+	syncRecord := &SyncRecord{
+		Dir:           baseDir,
+		SyncTimestamp: nowTimestamp,
+		SyncTime:      timeutil.TimestampToDateTime(nowTimestamp),
+		Files:         files,
+		Revision:      revision,
+		Channel:       config.Conf.Channel,
+		Manifest:      manifest,
+	}
+	return writeDataFile(path, syncRecord)
+}
+
+// isUpToDate 服务器文件列表版本及需要同步的文件与上次同步完成时一致
+func isUpToDate(baseDir string, serverFileInfo *ServerFileInfo) bool {
+	if serverFileInfo.Revision <= 0 {
+		return false
+	}
+	syncRecord, err := getSyncRecord(baseDir)
+	if err != nil || syncRecord == nil || syncRecord.Revision != serverFileInfo.Revision || syncRecord.Channel != config.Conf.Channel {
+		return false
+	}
+	recordFiles, err := json.Marshal(syncRecord.Files)
+	if err != nil {
+		return false
+	}
+	serverFiles, err := json.Marshal(serverFileInfo.Files)
+	if err != nil {
+		return false
+	}
+	return md5util.SumString(string(recordFiles)) == md5util.SumString(string(serverFiles))
+}
+
+// getSyncRecordFileMap 同步记录中的文件，key为统一使用/分隔的相对路径
+func getSyncRecordFileMap(syncRecord *SyncRecord) map[string]*FileInfo {
+	files := make(map[string]*FileInfo)
+	if syncRecord == nil {
+		return files
+	}
+	for _, file := range syncRecord.Files {
+		files[normalizeRelativePath(filepath.Clean(file.RelativePath))] = file
+	}
+	return files
+}
+
+// getSyncedPathMap 同步记录中的文件及同步时完整文件列表中的文件，key为统一使用/分隔的相对路径
+func getSyncedPathMap(syncRecord *SyncRecord) map[string]bool {
+	paths := make(map[string]bool)
+	if syncRecord == nil {
+		return paths
+	}
+	for path := range getSyncRecordFileMap(syncRecord) {
+		paths[path] = true
+	}
+	if syncRecord.Manifest == nil {
+		return paths
+	}
+	serverFileInfo, err := parseServerManifest(syncRecord.Manifest)
+	if err != nil {
+		log.Debugf("parse sync record manifest failed, err: %v\n", err)
+		return paths
+	}
+	for _, file := range serverFileInfo.Files {
+		paths[normalizeRelativePath(filepath.Clean(file.RelativePath))] = true
+	}
+	return paths
+}
+
+// getSyncedCachePath 文件上次同步时的版本在缓存中的路径，返回同步记录中的文件信息
+func getSyncedCachePath(fileInfo *FileInfo, baseDir string, cacheInfo *CacheInfo) (*FileInfo, string, bool) {
+	syncRecord, err := getSyncRecord(baseDir)
+	if err != nil {
+		return nil, "", false
+	}
+	recordFile, ok := getSyncRecordFileMap(syncRecord)[normalizeRelativePath(filepath.Clean(fileInfo.RelativePath))]
+	if !ok || recordFile.Type != TypeFile {
+		return nil, "", false
+	}
+	isCacheHit, cachePath, _ := checkCache(recordFile, cacheInfo)
+	return recordFile, cachePath, isCacheHit
+}
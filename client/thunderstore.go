@@ -0,0 +1,409 @@
+package client
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/comoyi/valheim-launcher/util/fsutil"
+	"github.com/comoyi/valheim-launcher/util/versionutil"
+	"github.com/comoyi/valheim-launcher/util/ziputil"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ThunderstoreManifest Thunderstore包中的manifest.json
+type ThunderstoreManifest struct {
+	Name          string   `json:"name"`
+	VersionNumber string   `json:"version_number"`
+	WebsiteUrl    string   `json:"website_url"`
+	Description   string   `json:"description"`
+	Dependencies  []string `json:"dependencies"`
+}
+
+// ThunderstorePackage 本地的Thunderstore包，manifest.json中没有作者，从文件名 作者-名称-版本.zip 中获取
+type ThunderstorePackage struct {
+	Path     string
+	Author   string
+	Manifest *ThunderstoreManifest
+}
+
+// Id 例：denikson-BepInExPack_Valheim
+func (p *ThunderstorePackage) Id() string {
+	if p.Author == "" {
+		return p.Manifest.Name
+	}
+	return fmt.Sprintf("%s-%s", p.Author, p.Manifest.Name)
+}
+
+// FullName 例：denikson-BepInExPack_Valheim-5.4.1901
+func (p *ThunderstorePackage) FullName() string {
+	return fmt.Sprintf("%s-%s", p.Id(), p.Manifest.VersionNumber)
+}
+
+func (p *ThunderstorePackage) isBepInExPack() bool {
+	return strings.HasPrefix(p.Manifest.Name, "BepInExPack")
+}
+
+func readThunderstoreManifest(path string) (*ThunderstoreManifest, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseThunderstoreManifest(content)
+}
+
+func parseThunderstoreManifest(content []byte) (*ThunderstoreManifest, error) {
+	// 部分manifest.json带有UTF-8 BOM
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	var manifest *ThunderstoreManifest
+	err := json.Unmarshal(content, &manifest)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil || manifest.Name == "" {
+		return nil, fmt.Errorf("invalid thunderstore manifest")
+	}
+	return manifest, nil
+}
+
+func readThunderstorePackage(zipPath string) (*ThunderstorePackage, error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var manifest *ThunderstoreManifest
+	for _, f := range zr.File {
+		if normalizeZipEntryName(f.Name) != "manifest.json" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		manifest, err = parseThunderstoreManifest(content)
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("manifest.json not found in %s", zipPath)
+	}
+
+	author := ""
+	name := strings.TrimSuffix(filepath.Base(zipPath), filepath.Ext(zipPath))
+	name = strings.TrimSuffix(name, "-"+manifest.VersionNumber)
+	if strings.HasSuffix(name, "-"+manifest.Name) {
+		author = strings.TrimSuffix(name, "-"+manifest.Name)
+	}
+	return &ThunderstorePackage{
+		Path:     zipPath,
+		Author:   author,
+		Manifest: manifest,
+	}, nil
+}
+
+// findThunderstorePackages 获取文件夹中的所有Thunderstore包，同一个包有多个版本时使用最新的版本
+func findThunderstorePackages(dir string) (map[string]*ThunderstorePackage, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	packages := make(map[string]*ThunderstorePackage)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".zip") {
+			continue
+		}
+		pkg, err := readThunderstorePackage(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			log.Debugf("skip invalid thunderstore package, file: %s, err: %v\n", entry.Name(), err)
+			continue
+		}
+		existing, ok := packages[pkg.Id()]
+		if ok && versionutil.Compare(existing.Manifest.VersionNumber, pkg.Manifest.VersionNumber) >= 0 {
+			continue
+		}
+		packages[pkg.Id()] = pkg
+	}
+	return packages, nil
+}
+
+// resolveThunderstoreDependencies 解析依赖，返回按安装顺序排列的包（依赖在前）和缺失的依赖
+// 游戏文件夹中已有BepInEx时，缺失的BepInExPack不视为缺失
+func resolveThunderstoreDependencies(baseDir string, pkg *ThunderstorePackage, available map[string]*ThunderstorePackage) ([]*ThunderstorePackage, []string) {
+	ordered := make([]*ThunderstorePackage, 0)
+	missing := make([]string, 0)
+	visited := make(map[string]bool)
+
+	isBepInExInstalled, _ := fsutil.Exists(filepath.Join(baseDir, "BepInEx", "core", "BepInEx.dll"))
+
+	var visit func(p *ThunderstorePackage)
+	visit = func(p *ThunderstorePackage) {
+		if visited[p.Id()] {
+			return
+		}
+		visited[p.Id()] = true
+		for _, dependency := range p.Manifest.Dependencies {
+			id, version := splitThunderstoreDependency(dependency)
+			dep, ok := available[id]
+			if !ok || versionutil.Compare(dep.Manifest.VersionNumber, version) < 0 {
+				if isBepInExInstalled && strings.Contains(id, "BepInExPack") {
+					continue
+				}
+				missing = append(missing, dependency)
+				continue
+			}
+			visit(dep)
+		}
+		ordered = append(ordered, p)
+	}
+	visit(pkg)
+	return ordered, missing
+}
+
+// splitThunderstoreDependency 例：denikson-BepInExPack_Valheim-5.4.1901 -> denikson-BepInExPack_Valheim, 5.4.1901
+func splitThunderstoreDependency(dependency string) (string, string) {
+	i := strings.LastIndex(dependency, "-")
+	if i < 0 {
+		return dependency, ""
+	}
+	return dependency[:i], dependency[i+1:]
+}
+
+// installThunderstorePackage 按BepInEx的目录结构安装Thunderstore包，返回安装的文件（相对路径）
+// 已存在的配置文件不会被覆盖
+func installThunderstorePackage(baseDir string, pkg *ThunderstorePackage) ([]string, error) {
+	zr, err := zip.OpenReader(pkg.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	// 先检查所有路径，包含非法路径的包不安装任何文件
+	localPaths := make(map[*zip.File]string)
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !f.Mode().IsRegular() {
+			continue
+		}
+		relativePath, _ := getThunderstoreInstallPath(pkg, normalizeZipEntryName(f.Name))
+		if relativePath == "" {
+			continue
+		}
+		localPath, err := ziputil.SafeJoin(baseDir, relativePath)
+		if err != nil {
+			log.Warnf("illegal path in thunderstore package, package: %s, entry: %s\n", pkg.FullName(), f.Name)
+			return nil, err
+		}
+		localPaths[f] = localPath
+	}
+
+	installedFiles := make([]string, 0)
+	for _, f := range zr.File {
+		localPath, ok := localPaths[f]
+		if !ok {
+			continue
+		}
+		relativePath, isConfig := getThunderstoreInstallPath(pkg, normalizeZipEntryName(f.Name))
+		if isConfig {
+			exists, err := fsutil.LExists(localPath)
+			if err != nil {
+				return installedFiles, err
+			}
+			if exists {
+				log.Debugf("[SKIP]config file exists, localPath: %s\n", localPath)
+				continue
+			}
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return installedFiles, err
+		}
+		err = writeLocalFile(localPath, baseDir, rc)
+		rc.Close()
+		if err != nil {
+			return installedFiles, err
+		}
+		installedFiles = append(installedFiles, filepath.FromSlash(relativePath))
+		log.Debugf("[IMPORT]%s, localPath: %s\n", pkg.FullName(), localPath)
+	}
+	return installedFiles, nil
+}
+
+// getThunderstoreInstallPath 获取zip中的文件在游戏文件夹中的相对路径（/分隔），返回空字符串代表不需要安装
+func getThunderstoreInstallPath(pkg *ThunderstorePackage, name string) (string, bool) {
+	parts := strings.SplitN(name, "/", 2)
+
+	if pkg.isBepInExPack() {
+		// BepInExPack_Valheim/ 下的文件安装到游戏根目录
+		if len(parts) == 2 && strings.HasPrefix(parts[0], "BepInExPack") {
+			return parts[1], strings.HasPrefix(strings.ToLower(parts[1]), "bepinex/config/")
+		}
+		return "", false
+	}
+
+	if len(parts) == 2 && strings.EqualFold(parts[0], "BepInEx") {
+		parts = strings.SplitN(parts[1], "/", 2)
+	}
+	if len(parts) == 1 {
+		return fmt.Sprintf("BepInEx/plugins/%s/%s", pkg.Id(), parts[0]), false
+	}
+	switch strings.ToLower(parts[0]) {
+	case "plugins":
+		return fmt.Sprintf("BepInEx/plugins/%s/%s", pkg.Id(), parts[1]), false
+	case "patchers":
+		return fmt.Sprintf("BepInEx/patchers/%s/%s", pkg.Id(), parts[1]), false
+	case "config":
+		return fmt.Sprintf("BepInEx/config/%s", parts[1]), true
+	case "core":
+		return fmt.Sprintf("BepInEx/core/%s", parts[1]), false
+	}
+	return fmt.Sprintf("BepInEx/plugins/%s/%s", pkg.Id(), strings.Join(parts, "/")), false
+}
+
+func normalizeZipEntryName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	return strings.TrimPrefix(name, "./")
+}
+
+// ImportRecord 某个游戏文件夹中导入的Thunderstore包，导入的文件在更新时不会被删除
+type ImportRecord struct {
+	Packages map[string]*ImportedPackage `json:"packages"`
+}
+
+type ImportedPackage struct {
+	Id      string   `json:"id"`
+	Version string   `json:"version"`
+	Files   []string `json:"files"`
+}
+
+func getImportRecordFilePath(baseDir string) (string, error) {
+	dirDataPath, err := getDirDataPath(baseDir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dirDataPath, "import-record.json"), nil
+}
+
+func getImportRecord(baseDir string) (*ImportRecord, error) {
+	importRecord := &ImportRecord{
+		Packages: make(map[string]*ImportedPackage),
+	}
+	path, err := getImportRecordFilePath(baseDir)
+	if err != nil {
+		return importRecord, err
+	}
+	_, err = readDataFile(path, importRecord)
+	if err != nil {
+		return importRecord, err
+	}
+	if importRecord.Packages == nil {
+		importRecord.Packages = make(map[string]*ImportedPackage)
+	}
+	return importRecord, nil
+}
+
+func saveImportRecord(baseDir string, importRecord *ImportRecord) error {
+	path, err := getImportRecordFilePath(baseDir)
+	if err != nil {
+		return err
+	}
+	return writeDataFile(path, importRecord)
+}
+
+// getImportedPathMap 导入的文件及其所在的各级文件夹，key为统一使用/分隔的相对路径
+func getImportedPathMap(importRecord *ImportRecord) map[string]bool {
+	paths := make(map[string]bool)
+	if importRecord == nil {
+		return paths
+	}
+	for _, pkg := range importRecord.Packages {
+		for _, file := range pkg.Files {
+			p := normalizeRelativePath(filepath.Clean(file))
+			for p != "." && p != "" && !paths[p] {
+				paths[p] = true
+				i := strings.LastIndex(p, "/")
+				if i < 0 {
+					break
+				}
+				p = p[:i]
+			}
+		}
+	}
+	return paths
+}
+
+// importThunderstorePackages 依次安装包并记录导入的文件
+func importThunderstorePackages(baseDir string, packages []*ThunderstorePackage) error {
+	importRecord, err := getImportRecord(baseDir)
+	if err != nil {
+		log.Warnf("get import record failed, err: %v\n", err)
+	}
+	for _, pkg := range packages {
+		files, err := installThunderstorePackage(baseDir, pkg)
+		if len(files) > 0 {
+			addImportedFiles(baseDir, importRecord, pkg.Id(), pkg.Manifest.VersionNumber, files)
+		}
+		if err != nil {
+			return err
+		}
+		addMsgWithTime(fmt.Sprintf("已导入 %s", pkg.FullName()))
+	}
+	return nil
+}
+
+// addImportedFiles 记录导入的文件，记录失败不影响导入
+// 从服务器同步的文件不记录，避免卸载导入的MOD时删除服务器的文件
+func addImportedFiles(baseDir string, importRecord *ImportRecord, id string, version string, files []string) {
+	syncRecord, err := getSyncRecord(baseDir)
+	if err != nil {
+		log.Warnf("get sync record failed, err: %v\n", err)
+	}
+	syncedPaths := getSyncedPathMap(syncRecord)
+	importedFiles := make([]string, 0, len(files))
+	for _, file := range files {
+		if syncedPaths[normalizeRelativePath(filepath.Clean(file))] {
+			log.Debugf("[SKIP]synced from server, not record as imported, file: %s\n", file)
+			continue
+		}
+		importedFiles = append(importedFiles, file)
+	}
+
+	importedPackage, ok := importRecord.Packages[id]
+	if !ok {
+		importedPackage = &ImportedPackage{Id: id}
+		importRecord.Packages[id] = importedPackage
+	}
+	importedPackage.Version = version
+	importedPackage.Files = mergeFileList(importedPackage.Files, importedFiles)
+	err = saveImportRecord(baseDir, importRecord)
+	if err != nil {
+		log.Warnf("save import record failed, err: %v\n", err)
+	}
+}
+
+func mergeFileList(a []string, b []string) []string {
+	exists := make(map[string]bool)
+	files := make([]string, 0, len(a)+len(b))
+	for _, list := range [][]string{a, b} {
+		for _, file := range list {
+			if exists[file] {
+				continue
+			}
+			exists[file] = true
+			files = append(files, file)
+		}
+	}
+	return files
+}
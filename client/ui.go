@@ -8,6 +8,7 @@ import (
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
 	theme2 "fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 	"github.com/comoyi/valheim-launcher/config"
@@ -15,12 +16,14 @@ import (
 	"github.com/comoyi/valheim-launcher/theme"
 	"github.com/comoyi/valheim-launcher/util/dialogutil"
 	"github.com/comoyi/valheim-launcher/util/fsutil"
+	"github.com/comoyi/valheim-launcher/util/sizeutil"
 	"github.com/comoyi/valheim-launcher/util/timeutil"
 	"github.com/spf13/viper"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 )
 
@@ -28,12 +31,17 @@ var w fyne.Window
 var c *fyne.Container
 var myApp fyne.App
 var msgContainer = widget.NewLabel("")
+var pathInput *widget.Label
+var startBundleUpdate func(baseDir string, bundlePath string)
+var requestUpdate func()
 
 func initUI() {
 	initMainWindow()
 
 	initMenu()
 
+	initTray()
+
 	go func() {
 		autoCleanMsg()
 	}()
@@ -48,11 +56,10 @@ func initMainWindow() {
 	w.SetMaster()
 	w.Resize(fyne.NewSize(800, 800))
 	c = container.NewVBox()
-	w.SetContent(c)
 
 	useStepLabel := widget.NewLabel("【使用步骤】第一步：选文件夹，第二步：更新MOD，第三步：启动英灵神殿\n【注意】更新MOD前请先关闭英灵神殿\n")
 	pathLabel := widget.NewLabel("英灵神殿所在文件夹，以下3种方式任选一种，推荐自动查找")
-	pathInput := widget.NewLabel("")
+	pathInput = widget.NewLabel("")
 	pathInput.SetText(config.Conf.Dir)
 
 	selectBtnText := "选择文件夹"
@@ -122,28 +129,18 @@ func initMainWindow() {
 	progressBar.TextFormatter = progressBarFormatter
 
 	var updateBtn *widget.Button
+	var startUpdate func(baseDir string, source fileSource, isWaitGameExit bool)
 
 	ctxParent := context.Background()
 	var cancel context.CancelFunc
 	isUpdating := false
 	updateBtnText := "更新MOD"
-	updateBtn = widget.NewButton(updateBtnText, func() {
-		baseDir := pathInput.Text
-		if baseDir == "" {
-			dialogutil.ShowInformation("提示", "请选择文件夹", w)
-			return
+	startUpdate = func(baseDir string, source fileSource, isWaitGameExit bool) {
+		if isWaitGameExit {
+			addMsgWithTime("等待英灵神殿退出后开始更新")
+		} else {
+			addMsgWithTime("开始更新")
 		}
-		baseDir = filepath.Clean(baseDir)
-
-		if isUpdating {
-			addMsgWithTime("取消更新")
-			isUpdating = false
-			updateBtn.SetText(updateBtnText)
-			cancel()
-			return
-		}
-
-		addMsgWithTime("开始更新")
 		isUpdating = true
 		updateBtn.SetText("取消更新")
 
@@ -158,42 +155,59 @@ func initMainWindow() {
 		ctx, cancel = context.WithCancel(ctxParent)
 
 		go func(ctx context.Context) {
+			defer source.close()
 			var err error
-			maxTimes := 3
-			triedTimes := 0
-		bf:
+			if isWaitGameExit {
+				err = waitGameExit(ctx, baseDir)
+				if err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					log.Debugf("wait game exit failed, err: %v\n", err)
+				} else {
+					addMsgWithTime("英灵神殿已退出，开始更新")
+				}
+				startTime = time.Now().Unix()
+			}
+
+			// 服务器刷新文件列表时等待刷新完成后重新更新，总等待时间超过serverScanWaitTimeout时放弃
+			waitDeadline := time.Now().Add(serverScanWaitTimeout)
 			for {
+				iterationStartTime := time.Now()
+				err = update(ctx, baseDir, source, progressChan)
+				if !errors.Is(err, errServerScanning) {
+					break
+				}
+				addMsgWithTime("服务器正在刷新文件列表，刷新完成后自动开始更新")
+				waitCtx, waitCancel := context.WithDeadline(ctx, waitDeadline)
+				err = waitServerScanCompleted(waitCtx)
+				waitCancel()
+				if ctx.Err() != nil {
+					return
+				}
+				if errors.Is(err, context.DeadlineExceeded) {
+					err = errServerScanTimeout
+					addMsgWithTime(err.Error())
+					break
+				}
+				if err != nil {
+					break
+				}
+				// 两次更新之间至少间隔serverScanRetryInterval，避免服务器状态不一致时频繁请求
 				select {
 				case <-ctx.Done():
 					return
-				default:
-					if triedTimes >= maxTimes {
-						log.Debugf("reach max retry times, triedTimes: %d, maxTimes: %d\n", triedTimes, maxTimes)
-						break bf
-					}
-					triedTimes++
-					err = update(ctx, baseDir, progressChan)
-					if err != nil {
-						if !errors.Is(err, errServerScanning) {
-							log.Debugf("not errServerScanning\n")
-							break bf
-						} else {
-							addMsgWithTime("服务器正在刷新文件列表，等待重试...")
-							select {
-							case <-ctx.Done():
-								return
-							case <-time.After(3 * time.Second):
-
-							}
-						}
-					} else {
-						break bf
-					}
+				case <-time.After(serverScanRetryInterval - time.Since(iterationStartTime)):
 				}
+				addMsgWithTime("服务器刷新文件列表完成，开始更新")
 			}
 			if err != nil {
 				if isUpdating {
-					dialogutil.ShowInformation("提示", "更新失败", w)
+					if errors.Is(err, errLauncherTooOld) {
+						showUpgradeLauncherDialog(err)
+					} else {
+						dialogutil.ShowInformation("提示", getUpdateFailedMsg(err), w)
+					}
 					addMsgWithTime("更新失败")
 					log.Debugf("update failed, err: %v\n", err)
 				}
@@ -229,9 +243,71 @@ func initMainWindow() {
 			}
 		}(ctx)
 
+	}
+	updateBtn = widget.NewButton(updateBtnText, func() {
+		baseDir := pathInput.Text
+		if baseDir == "" {
+			dialogutil.ShowInformation("提示", "请选择文件夹", w)
+			return
+		}
+		baseDir = filepath.Clean(baseDir)
+
+		if isUpdating {
+			addMsgWithTime("取消更新")
+			isUpdating = false
+			updateBtn.SetText(updateBtnText)
+			cancel()
+			return
+		}
+
+		isRunning, err := isGameRunning(baseDir)
+		if err != nil {
+			log.Debugf("check game process failed, err: %v\n", err)
+		}
+		if isRunning {
+			dialog.NewCustomConfirm("提示", "等待退出后更新", "取消", widget.NewLabel("检测到英灵神殿正在运行，更新MOD前请先关闭英灵神殿\n是否等待英灵神殿退出后自动开始更新？"), func(b bool) {
+				if b && !isUpdating {
+					startUpdate(baseDir, newServerSource(), true)
+				}
+			}, w).Show()
+			return
+		}
+
+		startUpdate(baseDir, newServerSource(), false)
 	})
 	updateBtn.SetIcon(theme2.ViewRefreshIcon())
 
+	requestUpdate = func() {
+		if isUpdating {
+			addMsgWithTime("正在更新")
+			return
+		}
+		updateBtn.OnTapped()
+	}
+
+	startBundleUpdate = func(baseDir string, bundlePath string) {
+		if isUpdating {
+			dialogutil.ShowInformation("提示", "正在更新，请稍后再试", w)
+			return
+		}
+		isRunning, err := isGameRunning(baseDir)
+		if err != nil {
+			log.Debugf("check game process failed, err: %v\n", err)
+		}
+		if isRunning {
+			dialogutil.ShowInformation("提示", "请先关闭英灵神殿", w)
+			return
+		}
+		source, err := openBundle(bundlePath)
+		if err != nil {
+			log.Warnf("open bundle failed, path: %s, err: %v\n", bundlePath, err)
+			dialogutil.ShowInformation("提示", "读取离线更新包失败", w)
+			return
+		}
+		addMsgWithTime(fmt.Sprintf("使用离线更新包：%s", bundlePath))
+		startUpdate(baseDir, source, false)
+	}
+
 	c.Add(useStepLabel)
 	c.Add(pathLabel)
 	c2 := container.NewAdaptiveGrid(3)
@@ -243,20 +319,141 @@ func initMainWindow() {
 	c3.Add(pathInput)
 	c.Add(c3)
 	startBtn := initStartBtn(pathInput)
-	c4 := container.NewAdaptiveGrid(2)
+	modGroupBtn := widget.NewButton("可选MOD", func() {
+		showModGroupsDialog()
+	})
+	modGroupBtn.SetIcon(theme2.ListIcon())
+	channelBtn := widget.NewButton("MOD包版本", func() {
+		showChannelDialog()
+	})
+	channelBtn.SetIcon(theme2.HistoryIcon())
+	c4 := container.NewAdaptiveGrid(4)
 	c4.Add(updateBtn)
+	c4.Add(modGroupBtn)
+	c4.Add(channelBtn)
 	c4.Add(startBtn)
 	c.Add(c4)
-	c5 := container.NewAdaptiveGrid(1)
-	c5.Add(progressBar)
+	c5 := container.NewBorder(nil, nil, nil, initRateLimitSelect(), progressBar)
 	c.Add(c5)
 
+	initServerStatus(c)
 	initAnnouncement(c)
 	initMsgContainer(c)
+
+	tabs := container.NewAppTabs(
+		container.NewTabItemWithIcon("首页", theme2.HomeIcon(), container.NewVScroll(c)),
+		container.NewTabItemWithIcon("MOD", theme2.ListIcon(), initModsTab(pathInput)),
+	)
+	w.SetContent(tabs)
+}
+
+func initModsTab(pathInput *widget.Label) fyne.CanvasObject {
+	headers := []string{"名称", "版本", "GUID", "来源", "路径"}
+	mods := make([]*InstalledMod, 0)
+	summaryLabel := widget.NewLabel("")
+
+	table := widget.NewTable(func() (int, int) {
+		return len(mods) + 1, len(headers)
+	}, func() fyne.CanvasObject {
+		return widget.NewLabel("")
+	}, func(id widget.TableCellID, o fyne.CanvasObject) {
+		label := o.(*widget.Label)
+		if id.Row == 0 {
+			label.TextStyle = fyne.TextStyle{Bold: true}
+			label.SetText(headers[id.Col])
+			return
+		}
+		label.TextStyle = fyne.TextStyle{}
+		mod := mods[id.Row-1]
+		switch id.Col {
+		case 0:
+			label.SetText(mod.Name)
+		case 1:
+			label.SetText(mod.Version)
+		case 2:
+			label.SetText(mod.GUID)
+		case 3:
+			label.SetText(mod.Source.String())
+		case 4:
+			label.SetText(mod.RelativePath)
+		}
+	})
+	colWidths := []float32{200, 90, 220, 110, 300}
+	for i, width := range colWidths {
+		table.SetColumnWidth(i, width)
+	}
+
+	refresh := func() {
+		baseDir := pathInput.Text
+		if baseDir == "" {
+			summaryLabel.SetText("请选择文件夹")
+			return
+		}
+		summaryLabel.SetText("正在扫描...")
+		go func() {
+			installedMods, err := getInstalledMods(filepath.Clean(baseDir))
+			if err != nil {
+				log.Warnf("get installed mods failed, err: %v\n", err)
+				summaryLabel.SetText("扫描失败")
+				return
+			}
+			counts := make(map[ModSource]int)
+			for _, mod := range installedMods {
+				counts[mod.Source]++
+			}
+			mods = installedMods
+			summaryLabel.SetText(fmt.Sprintf("共 %d 个MOD，%s：%d，%s：%d，%s：%d", len(mods),
+				ModSourceServer, counts[ModSourceServer],
+				ModSourceUser, counts[ModSourceUser],
+				ModSourceModified, counts[ModSourceModified]))
+			table.Refresh()
+		}()
+	}
+	refreshBtn := widget.NewButton("刷新", refresh)
+	refreshBtn.SetIcon(theme2.ViewRefreshIcon())
+
+	top := container.NewBorder(nil, nil, nil, refreshBtn, summaryLabel)
+	content := container.NewBorder(top, nil, nil, nil, table)
+	refresh()
+	return content
 }
 
 func initMenu() {
-	firstMenu := fyne.NewMenu("操作")
+	backupSavesMenuItem := fyne.NewMenuItem("备份存档", func() {
+		backupPath, err := backupSaves()
+		if err != nil {
+			dialogutil.ShowInformation("提示", "备份存档失败", w)
+			return
+		}
+		if backupPath == "" {
+			dialogutil.ShowInformation("提示", "没有需要备份的存档", w)
+			return
+		}
+		addMsgWithTime(fmt.Sprintf("备份存档完成：%s", backupPath))
+		dialogutil.ShowInformation("提示", "备份存档完成", w)
+	})
+	restoreSavesMenuItem := fyne.NewMenuItem("恢复存档", func() {
+		showRestoreSavesDialog()
+	})
+	importPackageMenuItem := fyne.NewMenuItem("导入Thunderstore MOD包", func() {
+		showImportPackageDialog()
+	})
+	exportR2ProfileMenuItem := fyne.NewMenuItem("导出r2modman配置", func() {
+		showExportR2ProfileDialog()
+	})
+	importR2ProfileMenuItem := fyne.NewMenuItem("导入r2modman配置", func() {
+		showImportR2ProfileDialog()
+	})
+	exportBundleMenuItem := fyne.NewMenuItem("导出离线更新包", func() {
+		showExportBundleDialog()
+	})
+	bundleUpdateMenuItem := fyne.NewMenuItem("从离线更新包更新", func() {
+		showBundleUpdateDialog()
+	})
+	uninstallModsMenuItem := fyne.NewMenuItem("卸载MOD", func() {
+		showUninstallModsDialog()
+	})
+	firstMenu := fyne.NewMenu("操作", backupSavesMenuItem, restoreSavesMenuItem, fyne.NewMenuItemSeparator(), importPackageMenuItem, exportR2ProfileMenuItem, importR2ProfileMenuItem, fyne.NewMenuItemSeparator(), exportBundleMenuItem, bundleUpdateMenuItem, fyne.NewMenuItemSeparator(), uninstallModsMenuItem)
 	helpMenuItem := fyne.NewMenuItem("关于", func() {
 		content := container.NewVBox()
 		appInfo := widget.NewLabel(appName)
@@ -274,11 +471,541 @@ func initMenu() {
 		content.Add(h)
 		dialog.NewCustom("关于", "关闭", content, w).Show()
 	})
-	helpMenu := fyne.NewMenu("帮助", helpMenuItem)
+	checkNewVersionMenuItem := fyne.NewMenuItem("检查启动器更新", func() {
+		go func() {
+			v, err := checkNewVersion()
+			if err != nil {
+				log.Debugf("check new version failed, err: %v\n", err)
+				dialogutil.ShowInformation("提示", "检查启动器更新失败", w)
+				return
+			}
+			if v == nil {
+				dialogutil.ShowInformation("提示", "已是最新版本", w)
+				return
+			}
+			showNewVersionDialog(v)
+		}()
+	})
+	helpMenu := fyne.NewMenu("帮助", checkNewVersionMenuItem, helpMenuItem)
 	mainMenu := fyne.NewMainMenu(firstMenu, helpMenu)
 	w.SetMainMenu(mainMenu)
 }
 
+// showUpgradeLauncherDialog 启动器版本过旧不能更新MOD时提示更新启动器
+func showUpgradeLauncherDialog(err error) {
+	msg := fmt.Sprintf("%s\n更新启动器后才能更新MOD", err)
+	dialog.NewCustomConfirm("需要更新启动器", "检查更新", "关闭", widget.NewLabel(msg), func(b bool) {
+		if !b {
+			return
+		}
+		go func() {
+			v, err := checkNewVersion()
+			if err != nil || v == nil {
+				log.Debugf("check new version failed, version: %+v, err: %v\n", v, err)
+				dialogutil.ShowInformation("提示", "获取启动器新版本失败，请联系服主获取新版本启动器", w)
+				return
+			}
+			showNewVersionDialog(v)
+		}()
+	}, w).Show()
+}
+
+// showNewVersionDialog 显示新版本的更新日志，可以自动更新时提供立即更新
+func showNewVersionDialog(v *Version) {
+	content := container.NewVBox()
+	content.Add(widget.NewLabel(fmt.Sprintf("发现新版本：%s （当前版本：%s）", v.Version, versionText)))
+	changeLog := widget.NewLabel(v.ChangeLog)
+	changeLog.Wrapping = fyne.TextWrapWord
+	changeLogScroll := container.NewVScroll(changeLog)
+	changeLogScroll.SetMinSize(fyne.NewSize(500, 250))
+	content.Add(changeLogScroll)
+
+	if !isSelfUpdatable(v) {
+		content.Add(widget.NewLabel("请手动下载新版本"))
+		if v.Url != "" {
+			link := widget.NewHyperlink(v.Url, nil)
+			_ = link.SetURLFromString(v.Url)
+			content.Add(link)
+		}
+		dialog.NewCustom("启动器更新", "关闭", content, w).Show()
+		return
+	}
+
+	dialog.NewCustomConfirm("启动器更新", "立即更新", "稍后", content, func(b bool) {
+		if !b {
+			return
+		}
+		addMsgWithTime(fmt.Sprintf("开始更新启动器到%s", v.Version))
+		go func() {
+			err := selfUpdate(v)
+			if err != nil {
+				log.Warnf("self update failed, err: %v\n", err)
+				addMsgWithTime("启动器更新失败")
+				dialogutil.ShowInformation("提示", fmt.Sprintf("启动器更新失败\n%s", err), w)
+				return
+			}
+			myApp.Quit()
+		}()
+	}, w).Show()
+}
+
+func showRestoreSavesDialog() {
+	backups, err := listSaveBackups()
+	if err != nil {
+		dialogutil.ShowInformation("提示", "获取存档备份失败", w)
+		return
+	}
+	if len(backups) == 0 {
+		dialogutil.ShowInformation("提示", "没有存档备份", w)
+		return
+	}
+
+	var selected *SaveBackup
+	list := widget.NewList(func() int {
+		return len(backups)
+	}, func() fyne.CanvasObject {
+		return widget.NewLabel("")
+	}, func(id widget.ListItemID, o fyne.CanvasObject) {
+		backup := backups[id]
+		o.(*widget.Label).SetText(fmt.Sprintf("%s    %s", timeutil.TimeToDateTime(backup.Time), sizeutil.FormatSize(backup.Size)))
+	})
+	list.OnSelected = func(id widget.ListItemID) {
+		selected = backups[id]
+	}
+	tipLabel := widget.NewLabel("恢复会覆盖当前的角色和世界存档（恢复前会自动备份当前存档），请先关闭英灵神殿")
+	listScroll := container.NewVScroll(list)
+	listScroll.SetMinSize(fyne.NewSize(500, 300))
+	content := container.NewBorder(tipLabel, nil, nil, nil, listScroll)
+
+	var restoreDialog dialog.Dialog
+	restoreDialog = dialog.NewCustomConfirm("恢复存档", "恢复", "取消", content, func(b bool) {
+		if !b {
+			return
+		}
+		if selected == nil {
+			dialogutil.ShowInformation("提示", "请选择要恢复的存档备份", w)
+			return
+		}
+		err := restoreSaveBackup(selected)
+		if err != nil {
+			dialogutil.ShowInformation("提示", "恢复存档失败", w)
+			return
+		}
+		addMsgWithTime(fmt.Sprintf("已恢复存档：%s", timeutil.TimeToDateTime(selected.Time)))
+		dialogutil.ShowInformation("提示", "恢复存档完成", w)
+	}, w)
+	restoreDialog.Show()
+}
+
+// getSelectedBaseDir 获取选择的游戏文件夹，未选择时提示
+func getSelectedBaseDir() (string, bool) {
+	baseDir := pathInput.Text
+	if baseDir == "" {
+		dialogutil.ShowInformation("提示", "请选择文件夹", w)
+		return "", false
+	}
+	return filepath.Clean(baseDir), true
+}
+
+func showImportPackageDialog() {
+	baseDir, ok := getSelectedBaseDir()
+	if !ok {
+		return
+	}
+	isRunning, err := isGameRunning(baseDir)
+	if err != nil {
+		log.Debugf("check game process failed, err: %v\n", err)
+	}
+	if isRunning {
+		dialogutil.ShowInformation("提示", "请先关闭英灵神殿", w)
+		return
+	}
+
+	fileOpenDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			log.Debugf("select file failed, err: %v\n", err)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		zipPath := filepath.Clean(reader.URI().Path())
+		_ = reader.Close()
+
+		pkg, err := readThunderstorePackage(zipPath)
+		if err != nil {
+			log.Warnf("read thunderstore package failed, err: %v\n", err)
+			dialogutil.ShowInformation("提示", "不是有效的Thunderstore MOD包", w)
+			return
+		}
+		available, err := findThunderstorePackages(filepath.Dir(zipPath))
+		if err != nil {
+			log.Warnf("find thunderstore packages failed, err: %v\n", err)
+			available = make(map[string]*ThunderstorePackage)
+		}
+		available[pkg.Id()] = pkg
+		packages, missing := resolveThunderstoreDependencies(baseDir, pkg, available)
+
+		names := make([]string, 0, len(packages))
+		for _, p := range packages {
+			names = append(names, p.FullName())
+		}
+		msg := fmt.Sprintf("将安装以下MOD包到\n%s\n\n%s", baseDir, strings.Join(names, "\n"))
+		if len(missing) > 0 {
+			msg = fmt.Sprintf("%s\n\n缺少以下依赖（请将依赖的zip放到同一个文件夹中）：\n%s", msg, strings.Join(missing, "\n"))
+		}
+		dialog.NewCustomConfirm("导入Thunderstore MOD包", "导入", "取消", widget.NewLabel(msg), func(b bool) {
+			if !b {
+				return
+			}
+			err := importThunderstorePackages(baseDir, packages)
+			if err != nil {
+				log.Warnf("import thunderstore packages failed, err: %v\n", err)
+				dialogutil.ShowInformation("提示", "导入失败", w)
+				return
+			}
+			dialogutil.ShowInformation("提示", "导入完成", w)
+		}, w).Show()
+	}, w)
+	fileOpenDialog.SetFilter(storage.NewExtensionFileFilter([]string{".zip"}))
+	fileOpenDialog.Show()
+}
+
+func showExportR2ProfileDialog() {
+	baseDir, ok := getSelectedBaseDir()
+	if !ok {
+		return
+	}
+	fileSaveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			log.Debugf("select file failed, err: %v\n", err)
+			return
+		}
+		if writer == nil {
+			return
+		}
+		defer writer.Close()
+		profileName := strings.TrimSuffix(writer.URI().Name(), writer.URI().Extension())
+		err = exportR2Profile(baseDir, profileName, writer)
+		if err != nil {
+			log.Warnf("export r2modman profile failed, err: %v\n", err)
+			dialogutil.ShowInformation("提示", "导出失败", w)
+			return
+		}
+		addMsgWithTime(fmt.Sprintf("已导出r2modman配置：%s", writer.URI().Path()))
+		dialogutil.ShowInformation("提示", "导出完成，可在r2modman中通过 导入配置 使用", w)
+	}, w)
+	fileSaveDialog.SetFileName("valheim-launcher.r2z")
+	fileSaveDialog.SetFilter(storage.NewExtensionFileFilter([]string{".r2z"}))
+	fileSaveDialog.Show()
+}
+
+func showImportR2ProfileDialog() {
+	baseDir, ok := getSelectedBaseDir()
+	if !ok {
+		return
+	}
+	isRunning, err := isGameRunning(baseDir)
+	if err != nil {
+		log.Debugf("check game process failed, err: %v\n", err)
+	}
+	if isRunning {
+		dialogutil.ShowInformation("提示", "请先关闭英灵神殿", w)
+		return
+	}
+
+	fileOpenDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			log.Debugf("select file failed, err: %v\n", err)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		r2zPath := filepath.Clean(reader.URI().Path())
+		_ = reader.Close()
+
+		dialog.NewCustomConfirm("导入r2modman配置", "导入", "取消", widget.NewLabel(fmt.Sprintf("将导入配置中的BepInEx文件夹到\n%s\n同名文件会被覆盖", baseDir)), func(b bool) {
+			if !b {
+				return
+			}
+			profile, missingMods, err := importR2Profile(baseDir, r2zPath)
+			if err != nil {
+				log.Warnf("import r2modman profile failed, err: %v\n", err)
+				dialogutil.ShowInformation("提示", "导入失败", w)
+				return
+			}
+			addMsgWithTime(fmt.Sprintf("已导入r2modman配置：%s", profile.ProfileName))
+			if len(missingMods) > 0 {
+				names := make([]string, 0, len(missingMods))
+				for _, mod := range missingMods {
+					names = append(names, fmt.Sprintf("%s-%s", mod.Name, mod.Version()))
+				}
+				dialogutil.ShowInformation("提示", fmt.Sprintf("导入完成，配置中的以下MOD没有包含文件，请另外安装：\n%s", strings.Join(names, "\n")), w)
+				return
+			}
+			dialogutil.ShowInformation("提示", "导入完成", w)
+		}, w).Show()
+	}, w)
+	fileOpenDialog.SetFilter(storage.NewExtensionFileFilter([]string{".r2z", ".zip"}))
+	fileOpenDialog.Show()
+}
+
+func showExportBundleDialog() {
+	baseDir, ok := getSelectedBaseDir()
+	if !ok {
+		return
+	}
+	fileSaveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			log.Debugf("select file failed, err: %v\n", err)
+			return
+		}
+		if writer == nil {
+			return
+		}
+		defer writer.Close()
+		addMsgWithTime("开始导出离线更新包")
+		missingFiles, err := exportBundle(baseDir, writer)
+		if err != nil {
+			log.Warnf("export bundle failed, err: %v\n", err)
+			if errors.Is(err, errNoSyncRecord) {
+				dialogutil.ShowInformation("提示", "没有同步记录，请先更新MOD", w)
+				return
+			}
+			addMsgWithTime("导出离线更新包失败")
+			dialogutil.ShowInformation("提示", "导出失败", w)
+			return
+		}
+		for _, file := range missingFiles {
+			addMsgWithTime(fmt.Sprintf("[未导出]缓存和游戏文件夹中都没有该文件：%s", file))
+		}
+		addMsgWithTime(fmt.Sprintf("已导出离线更新包：%s", writer.URI().Path()))
+		dialogutil.ShowInformation("提示", "导出完成", w)
+	}, w)
+	fileSaveDialog.SetFileName("valheim-launcher-bundle.zip")
+	fileSaveDialog.SetFilter(storage.NewExtensionFileFilter([]string{".zip"}))
+	fileSaveDialog.Show()
+}
+
+func showBundleUpdateDialog() {
+	baseDir, ok := getSelectedBaseDir()
+	if !ok {
+		return
+	}
+	fileOpenDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			log.Debugf("select file failed, err: %v\n", err)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		bundlePath := filepath.Clean(reader.URI().Path())
+		_ = reader.Close()
+		startBundleUpdate(baseDir, bundlePath)
+	}, w)
+	fileOpenDialog.SetFilter(storage.NewExtensionFileFilter([]string{".zip"}))
+	fileOpenDialog.Show()
+}
+
+func showUninstallModsDialog() {
+	baseDir, ok := getSelectedBaseDir()
+	if !ok {
+		return
+	}
+	relativePaths, _, err := getUninstallPaths(baseDir)
+	if err != nil {
+		dialogutil.ShowInformation("提示", "获取MOD文件失败", w)
+		return
+	}
+	if len(relativePaths) == 0 {
+		dialogutil.ShowInformation("提示", "没有需要卸载的MOD", w)
+		return
+	}
+
+	content := container.NewVBox()
+	content.Add(widget.NewLabel(fmt.Sprintf("将从以下文件夹删除BepInEx及启动器安装的所有MOD文件\n%s\n存档和其他文件不会被删除", baseDir)))
+	backupCheck := widget.NewCheck("卸载前备份MOD文件", nil)
+	backupCheck.SetChecked(true)
+	content.Add(backupCheck)
+	dialog.NewCustomConfirm("卸载MOD", "卸载", "取消", content, func(b bool) {
+		if !b {
+			return
+		}
+		addMsgWithTime("开始卸载MOD")
+		backupPath, err := uninstallMods(baseDir, backupCheck.Checked)
+		if err != nil {
+			log.Warnf("uninstall mods failed, err: %v\n", err)
+			if errors.Is(err, errGameRunning) {
+				dialogutil.ShowInformation("提示", "请先关闭英灵神殿", w)
+				return
+			}
+			addMsgWithTime("卸载MOD失败")
+			dialogutil.ShowInformation("提示", "卸载MOD失败", w)
+			return
+		}
+		if backupPath != "" {
+			addMsgWithTime(fmt.Sprintf("已备份MOD文件：%s", backupPath))
+		}
+		addMsgWithTime("卸载MOD完成")
+		dialogutil.ShowInformation("提示", "卸载MOD完成，可在Steam中验证游戏文件完整性", w)
+	}, w).Show()
+}
+
+func showModGroupsDialog() {
+	go func() {
+		serverFileInfo, err := getServerFileInfo()
+		if err != nil {
+			dialogutil.ShowInformation("提示", "从服务器获取MOD列表失败", w)
+			return
+		}
+		groups := make([]*ModGroup, 0)
+		for _, group := range serverFileInfo.ModGroups {
+			if isOptionalModGroup(group) {
+				groups = append(groups, group)
+			}
+		}
+		if len(groups) == 0 {
+			dialogutil.ShowInformation("提示", "服务器没有提供可选MOD", w)
+			return
+		}
+
+		modChoices, err := getModChoices()
+		if err != nil {
+			log.Warnf("get mod choices failed, use default, err: %v\n", err)
+		}
+
+		list := container.NewVBox()
+		checks := make(map[string]*widget.Check)
+		for _, group := range groups {
+			check := widget.NewCheck(group.Name, nil)
+			check.SetChecked(isModGroupEnabled(group, modChoices))
+			checks[group.Id] = check
+			list.Add(check)
+			if group.Description != "" {
+				descriptionLabel := widget.NewLabel(group.Description)
+				descriptionLabel.Wrapping = fyne.TextWrapWord
+				list.Add(descriptionLabel)
+			}
+		}
+		tipLabel := widget.NewLabel("勾选需要的MOD，点击更新MOD后生效，取消勾选的MOD会在更新时删除")
+		listScroll := container.NewVScroll(list)
+		listScroll.SetMinSize(fyne.NewSize(500, 300))
+		content := container.NewBorder(tipLabel, nil, nil, nil, listScroll)
+
+		dialog.NewCustomConfirm("可选MOD", "保存", "取消", content, func(b bool) {
+			if !b {
+				return
+			}
+			for id, check := range checks {
+				modChoices[id] = check.Checked
+			}
+			err := saveModChoices(modChoices)
+			if err != nil {
+				dialogutil.ShowInformation("提示", "保存失败", w)
+				return
+			}
+			addMsgWithTime("可选MOD已保存，点击更新MOD后生效")
+		}, w).Show()
+	}()
+}
+
+// showChannelDialog 选择发布通道及固定的MOD包版本
+func showChannelDialog() {
+	channels := []string{""}
+	channels = append(channels, getServerInfo().Channels...)
+	isCurrentChannelExist := false
+	for _, channel := range channels {
+		if channel == config.Conf.Channel {
+			isCurrentChannelExist = true
+		}
+	}
+	if !isCurrentChannelExist {
+		channels = append(channels, config.Conf.Channel)
+	}
+	channelOptions := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		channelOptions = append(channelOptions, formatChannel(channel))
+	}
+
+	selectedChannel := config.Conf.Channel
+	pinnedRevision := config.Conf.PinnedRevision
+	revisions := make([]*RevisionInfo, 0)
+	tipLabel := widget.NewLabel("")
+	list := widget.NewList(func() int {
+		return len(revisions) + 1
+	}, func() fyne.CanvasObject {
+		return widget.NewLabel("")
+	}, func(id widget.ListItemID, o fyne.CanvasObject) {
+		if id == 0 {
+			o.(*widget.Label).SetText(formatPinnedRevision(0))
+			return
+		}
+		revision := revisions[id-1]
+		o.(*widget.Label).SetText(fmt.Sprintf("%s    %s    %s", formatPinnedRevision(revision.Revision), timeutil.TimestampToDateTime(revision.Time), revision.Description))
+	})
+	list.OnSelected = func(id widget.ListItemID) {
+		if id == 0 {
+			pinnedRevision = 0
+			return
+		}
+		pinnedRevision = revisions[id-1].Revision
+	}
+	loadRevisions := func(channel string) {
+		tipLabel.SetText("正在获取历史版本...")
+		go func() {
+			r, err := getRevisions(channel)
+			if err != nil {
+				log.Debugf("get revisions failed, err: %v\n", err)
+				tipLabel.SetText("获取历史版本失败")
+				r = make([]*RevisionInfo, 0)
+			} else {
+				tipLabel.SetText("选择最新版本会在服务器发布新版本后同步新版本，选择历史版本会固定同步该版本")
+			}
+			revisions = r
+			list.Refresh()
+			for i, revision := range revisions {
+				if revision.Revision == pinnedRevision {
+					list.Select(i + 1)
+					return
+				}
+			}
+			list.Select(0)
+		}()
+	}
+
+	channelSelect := widget.NewSelect(channelOptions, func(s string) {
+		for _, channel := range channels {
+			if formatChannel(channel) == s && channel != selectedChannel {
+				selectedChannel = channel
+				pinnedRevision = 0
+				loadRevisions(channel)
+			}
+		}
+	})
+	channelSelect.SetSelected(formatChannel(selectedChannel))
+	loadRevisions(selectedChannel)
+
+	currentLabel := widget.NewLabel(fmt.Sprintf("当前：%s通道，%s", formatChannel(config.Conf.Channel), formatPinnedRevision(config.Conf.PinnedRevision)))
+	top := container.NewVBox(currentLabel, container.NewHBox(widget.NewLabel("发布通道"), channelSelect), tipLabel)
+	listScroll := container.NewVScroll(list)
+	listScroll.SetMinSize(fyne.NewSize(500, 300))
+	content := container.NewBorder(top, nil, nil, nil, listScroll)
+
+	dialog.NewCustomConfirm("MOD包版本", "保存", "取消", content, func(b bool) {
+		if !b {
+			return
+		}
+		err := saveChannelConfig(selectedChannel, pinnedRevision)
+		if err != nil {
+			dialogutil.ShowInformation("提示", "保存失败", w)
+			return
+		}
+		addMsgWithTime(fmt.Sprintf("MOD包版本已切换为：%s通道，%s，点击更新MOD后生效", formatChannel(selectedChannel), formatPinnedRevision(pinnedRevision)))
+	}, w).Show()
+}
+
 func initManualInputBtn(c *fyne.Container, pathInput *widget.Label) {
 	var manualInputDialog dialog.Dialog
 	inputBtnText := "手动输入文件夹地址"
@@ -362,13 +1089,60 @@ func initStartBtn(pathInput *widget.Label) *widget.Button {
 			addMsgWithTime("启动失败，请通过其他方式启动")
 			return
 		}
+
+		go watchLaunchedGame(context.Background(), baseDir)
 	})
 	btn.SetIcon(theme2.MediaPlayIcon())
 	return btn
 }
 
+// initRateLimitSelect 全局下载限速，更新过程中修改也会立即生效
+func initRateLimitSelect() fyne.CanvasObject {
+	options := make([]string, 0, len(downloadRateLimitOptions))
+	for _, limit := range downloadRateLimitOptions {
+		options = append(options, formatRateLimit(limit))
+	}
+	rateLimitSelect := widget.NewSelect(options, func(s string) {
+		for _, limit := range downloadRateLimitOptions {
+			if formatRateLimit(limit) != s || limit == config.Conf.DownloadRateLimit {
+				continue
+			}
+			setDownloadRateLimit(limit)
+			addMsgWithTime(fmt.Sprintf("下载限速：%s", s))
+			viper.Set("download_rate_limit", limit)
+			err := config.SaveConfig()
+			if err != nil {
+				log.Debugf("save config failed, err: %+v\n", err)
+			}
+		}
+	})
+	current := formatRateLimit(config.Conf.DownloadRateLimit)
+	isFound := false
+	for _, option := range options {
+		if option == current {
+			isFound = true
+		}
+	}
+	if !isFound {
+		// 配置文件中自定义的限速
+		rateLimitSelect.Options = append(rateLimitSelect.Options, current)
+	}
+	rateLimitSelect.SetSelected(current)
+	return container.NewHBox(widget.NewLabel("下载限速"), rateLimitSelect)
+}
+
+func formatRateLimit(limit int64) string {
+	if limit <= 0 {
+		return "不限速"
+	}
+	if limit >= 1024 && limit%1024 == 0 {
+		return fmt.Sprintf("%d MB/s", limit/1024)
+	}
+	return fmt.Sprintf("%d KB/s", limit)
+}
+
 func initAnnouncement(c *fyne.Container) {
-	var announcementContainer = widget.NewLabel("")
+	var announcementContainer = container.NewVBox()
 	announcementBox := container.NewVBox()
 	announcementLabel := widget.NewLabel("公告")
 	announcementContainerScroll := container.NewScroll(announcementContainer)
@@ -379,13 +1153,36 @@ func initAnnouncement(c *fyne.Container) {
 	c.Add(announcementBox)
 
 	go func() {
-		refreshAnnouncement(announcementContainer, announcementBox, c)
+		refreshAnnouncement(announcementLabel, announcementContainer, announcementBox, c)
 		interval := config.Conf.AnnouncementRefreshInterval
 		if interval > 0 {
 			for {
 				select {
 				case <-time.After(time.Duration(interval) * time.Second):
-					refreshAnnouncement(announcementContainer, announcementBox, c)
+					refreshAnnouncement(announcementLabel, announcementContainer, announcementBox, c)
+				}
+			}
+		}
+	}()
+}
+
+func initServerStatus(c *fyne.Container) {
+	var serverStatusContainer = widget.NewLabel("")
+	serverStatusBox := container.NewVBox()
+	serverStatusLabel := widget.NewLabel("服务器状态")
+	serverStatusBox.Hide()
+	serverStatusBox.Add(serverStatusLabel)
+	serverStatusBox.Add(serverStatusContainer)
+	c.Add(serverStatusBox)
+
+	go func() {
+		refreshServerStatus(serverStatusContainer, serverStatusBox, c)
+		interval := config.Conf.ServerStatusRefreshInterval
+		if interval > 0 {
+			for {
+				select {
+				case <-time.After(time.Duration(interval) * time.Second):
+					refreshServerStatus(serverStatusContainer, serverStatusBox, c)
 				}
 			}
 		}
@@ -410,6 +1207,28 @@ func refreshProgressbar(progressBar *widget.ProgressBar) {
 	}
 }
 
+func getUpdateFailedMsg(err error) string {
+	if errors.Is(err, errGameRunning) {
+		return "更新失败，请先关闭英灵神殿"
+	}
+	if errors.Is(err, errManifestSignature) {
+		return "更新失败，文件列表签名校验失败"
+	}
+	if isIncompatibleErr(err) {
+		return fmt.Sprintf("更新失败，%s", err)
+	}
+	if errors.Is(err, errNoChannelDownloadServer) {
+		return fmt.Sprintf("更新失败，%s", err)
+	}
+	if errors.Is(err, errServerScanTimeout) {
+		return fmt.Sprintf("更新失败，%s", err)
+	}
+	if errors.Is(err, errGameVersionMismatch) {
+		return "更新失败，本地游戏版本与MOD包要求的版本不一致\n请先通过Steam更新游戏，详情见下方信息"
+	}
+	return "更新失败"
+}
+
 func addMsgWithTime(msg string) {
 	msg = fmt.Sprintf("%s %s", timeutil.GetCurrentDateTime(), msg)
 	addMsg(msg)
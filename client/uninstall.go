@@ -0,0 +1,296 @@
+package client
+
+import (
+	"fmt"
+	"github.com/comoyi/valheim-launcher/log"
+	"github.com/comoyi/valheim-launcher/util/fsutil"
+	"github.com/comoyi/valheim-launcher/util/ziputil"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const modBackupPrefix = "mods-"
+
+// BepInEx安装到游戏文件夹中的文件和文件夹，卸载时即使不在同步记录中也会删除
+var bepInExInstallPaths = []string{
+	"BepInEx",
+	"doorstop_libs",
+	"unstripped_corlib",
+	"winhttp.dll",
+	"doorstop_config.ini",
+	"start_game_bepinex.sh",
+	"start_server_bepinex.sh",
+}
+
+// getUninstallPaths 获取卸载时要删除的文件（相对路径），包括BepInEx相关文件以及同步、导入记录中的文件
+// 只删除文件和符号链接，文件夹在删除文件后为空时再删除，同时返回BepInEx相关的文件夹（绝对路径）用于删除空文件夹
+func getUninstallPaths(baseDir string) ([]string, []string, error) {
+	pathMap := make(map[string]string)
+	dirs := make([]string, 0)
+	// addPath isRecord为true时为同步、导入记录中的路径，需要检查是否允许删除，文件夹会被忽略
+	addPath := func(relativePath string, isRecord bool) error {
+		relativePath = filepath.Clean(relativePath)
+		if relativePath == "." || relativePath == "" {
+			return nil
+		}
+		path := filepath.Join(baseDir, relativePath)
+		isBelong, err := isBelongDir(path, baseDir)
+		if err != nil {
+			return err
+		}
+		if !isBelong || path == baseDir {
+			log.Warnf("[SKIP]not in game dir, relativePath: %s\n", relativePath)
+			return nil
+		}
+		if isRecord {
+			isAllow, err := isAllowDelete(path, baseDir, relativePath)
+			if err != nil {
+				return err
+			}
+			if !isAllow {
+				log.Warnf("[SKIP]not allow delete, relativePath: %s\n", relativePath)
+				return nil
+			}
+		}
+		isExcluded, err := isUninstallExcluded(path)
+		if err != nil {
+			return err
+		}
+		if isExcluded {
+			return nil
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			if !isRecord {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() || info.Mode()&os.ModeSymlink != 0 {
+			pathMap[normalizeRelativePath(relativePath)] = relativePath
+		}
+		return nil
+	}
+
+	for _, p := range bepInExInstallPaths {
+		root := filepath.Join(baseDir, p)
+		exists, err := fsutil.LExists(root)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !exists {
+			continue
+		}
+		// WalkDir不会进入符号链接指向的文件夹
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			relativePath, err := filepath.Rel(baseDir, path)
+			if err != nil {
+				return err
+			}
+			return addPath(relativePath, false)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	syncRecord, err := getSyncRecord(baseDir)
+	if err != nil {
+		log.Warnf("get sync record failed, err: %v\n", err)
+		return nil, nil, err
+	}
+	if syncRecord != nil {
+		for _, file := range syncRecord.Files {
+			if file.Type != TypeFile && file.Type != TypeSymlink {
+				continue
+			}
+			err = addPath(file.RelativePath, true)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	importRecord, err := getImportRecord(baseDir)
+	if err != nil {
+		log.Warnf("get import record failed, err: %v\n", err)
+		return nil, nil, err
+	}
+	for _, pkg := range importRecord.Packages {
+		for _, file := range pkg.Files {
+			err = addPath(file, true)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(pathMap))
+	for k := range pathMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	relativePaths := make([]string, 0, len(keys))
+	for _, k := range keys {
+		relativePaths = append(relativePaths, pathMap[k])
+	}
+	return relativePaths, dirs, nil
+}
+
+// isUninstallExcluded 启动器自己的缓存、数据和备份文件夹可能位于游戏文件夹中，卸载时跳过
+func isUninstallExcluded(path string) (bool, error) {
+	dirs := make([]string, 0, 3)
+	cacheDirPath, err := getCacheDirPath()
+	if err != nil {
+		return false, err
+	}
+	dirs = append(dirs, cacheDirPath)
+	dataDirPath, err := getDataDirPath()
+	if err != nil {
+		return false, err
+	}
+	dirs = append(dirs, dataDirPath)
+	backupDirPath, err := getSaveBackupDirPath()
+	if err != nil {
+		return false, err
+	}
+	dirs = append(dirs, backupDirPath)
+
+	for _, dir := range dirs {
+		isBelong, err := isBelongDir(path, dir)
+		if err != nil {
+			return false, err
+		}
+		if isBelong {
+			return true, nil
+		}
+		// 要删除的文件夹中包含启动器的文件夹
+		isBelong, err = isBelongDir(dir, path)
+		if err != nil {
+			return false, err
+		}
+		if isBelong {
+			log.Warnf("[SKIP]contains launcher dir, path: %s, dir: %s\n", path, dir)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// uninstallMods 删除启动器安装的MOD文件，isBackup为true时先将要删除的文件压缩备份，返回备份文件路径
+func uninstallMods(baseDir string, isBackup bool) (string, error) {
+	isRunning, err := isGameRunning(baseDir)
+	if err != nil {
+		log.Debugf("check game process failed, err: %v\n", err)
+	}
+	if isRunning {
+		return "", errGameRunning
+	}
+
+	relativePaths, installDirs, err := getUninstallPaths(baseDir)
+	if err != nil {
+		return "", err
+	}
+
+	backupPath := ""
+	if isBackup && len(relativePaths) > 0 {
+		backupPath, err = backupMods(baseDir, relativePaths)
+		if err != nil {
+			log.Warnf("backup mods failed, err: %v\n", err)
+			return "", err
+		}
+	}
+
+	dirs := make(map[string]bool)
+	for _, dir := range installDirs {
+		dirs[dir] = true
+	}
+	for _, relativePath := range relativePaths {
+		path := filepath.Join(baseDir, relativePath)
+		err = os.Remove(path)
+		if err != nil {
+			log.Warnf("delete file failed, err: %v, file: %s\n", err, relativePath)
+			return backupPath, err
+		}
+		log.Debugf("[DELETE]uninstall, localPath: %s\n", path)
+		dirs[filepath.Dir(path)] = true
+	}
+	removeEmptyDirs(baseDir, dirs)
+
+	dirDataPath, err := getDirDataPath(baseDir)
+	if err != nil {
+		return backupPath, err
+	}
+	err = os.RemoveAll(dirDataPath)
+	if err != nil {
+		log.Warnf("delete dir data failed, err: %v, path: %s\n", err, dirDataPath)
+		return backupPath, err
+	}
+	return backupPath, nil
+}
+
+// removeEmptyDirs 删除文件后逐级向上删除空文件夹，不会删除baseDir
+func removeEmptyDirs(baseDir string, dirs map[string]bool) {
+	paths := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		paths = append(paths, dir)
+	}
+	// 深的文件夹先处理
+	sort.Slice(paths, func(i, j int) bool {
+		return len(paths[i]) > len(paths[j])
+	})
+	for _, dir := range paths {
+		for dir != baseDir {
+			isBelong, err := isBelongDir(dir, baseDir)
+			if err != nil || !isBelong {
+				break
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil || len(entries) > 0 {
+				break
+			}
+			err = os.Remove(dir)
+			if err != nil {
+				break
+			}
+			log.Debugf("[DELETE]empty dir, localPath: %s\n", dir)
+			dir = filepath.Dir(dir)
+		}
+	}
+}
+
+// backupMods 将要删除的文件压缩到备份文件夹
+func backupMods(baseDir string, relativePaths []string) (string, error) {
+	backupDirPath, err := getSaveBackupDirPath()
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(backupDirPath, os.ModePerm)
+	if err != nil {
+		log.Debugf("create backup dir failed, dir: %s, err: %v\n", backupDirPath, err)
+		return "", err
+	}
+
+	backupName := fmt.Sprintf("%s%s%s", modBackupPrefix, time.Now().Format(saveBackupTimeLayout), saveBackupSuffix)
+	backupPath := filepath.Join(backupDirPath, backupName)
+	err = ziputil.Compress(backupPath, baseDir, relativePaths)
+	if err != nil {
+		log.Debugf("compress mods failed, backupPath: %s, err: %v\n", backupPath, err)
+		_ = os.Remove(backupPath)
+		return "", err
+	}
+	log.Debugf("backup mods, backupPath: %s\n", backupPath)
+	return backupPath, nil
+}
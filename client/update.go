@@ -2,12 +2,13 @@ package client
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/comoyi/valheim-launcher/config"
 	"github.com/comoyi/valheim-launcher/log"
 	"github.com/comoyi/valheim-launcher/util/cryptoutil/md5util"
 	"github.com/comoyi/valheim-launcher/util/fsutil"
+	"github.com/comoyi/valheim-launcher/util/timeutil"
 	"io"
 	"io/fs"
 	"math/rand"
@@ -28,7 +29,7 @@ var UpdateInf *UpdateInfo = &UpdateInfo{}
 var errServerScanning = fmt.Errorf("服务器正在刷新文件列表，请稍后再试")
 var errNotInBaseDir = fmt.Errorf("not in baseDir")
 
-func update(ctx context.Context, baseDir string, progressChan chan<- struct{}) error {
+func update(ctx context.Context, baseDir string, source fileSource, progressChan chan<- struct{}) error {
 	log.Infof("baseDir: %v\n", baseDir)
 
 	if baseDir == "" {
@@ -36,16 +37,51 @@ func update(ctx context.Context, baseDir string, progressChan chan<- struct{}) e
 		return fmt.Errorf("invalid base dir")
 	}
 
-	j, err := httpGet(getFullUrl("/files"))
+	isRunning, err := isGameRunning(baseDir)
 	if err != nil {
-		log.Debugf("request failed, err: %v\n", err)
-		addMsgWithTime("从服务器获取文件列表失败")
+		log.Debugf("check game process failed, err: %v\n", err)
+	}
+	if isRunning {
+		addMsgWithTime("英灵神殿正在运行，请先关闭英灵神殿")
+		return errGameRunning
+	}
+
+	if _, ok := source.(*serverSource); ok {
+		err = checkDownloadServers()
+		if err != nil {
+			addMsgWithTime(err.Error())
+			return err
+		}
+	}
+
+	manifest, err := source.getServerManifest()
+	if err != nil {
+		if isIncompatibleErr(err) {
+			addMsgWithTime(err.Error())
+		} else {
+			addMsgWithTime(fmt.Sprintf("从%s获取文件列表失败", source))
+		}
+		return err
+	}
+	serverFileInfo, err := parseServerManifest(manifest)
+	if err != nil {
+		if errors.Is(err, errManifestSignature) {
+			addMsgWithTime("文件列表签名校验失败")
+		} else {
+			addMsgWithTime(fmt.Sprintf("从%s获取文件列表失败", source))
+		}
 		return err
 	}
-	var serverFileInfo *ServerFileInfo
-	err = json.Unmarshal([]byte(j), &serverFileInfo)
+
+	isOffline := false
+	if s, ok := source.(*serverSource); ok && s.isOffline() {
+		isOffline = true
+		addMsgWithTime(fmt.Sprintf("无法连接服务器，使用%s获取的文件列表校验本地文件", timeutil.TimestampToDateTime(s.offlineTime)))
+	}
+
+	err = checkMinLauncherVersion(serverFileInfo.MinLauncherVersion)
 	if err != nil {
-		log.Debugf("json.Unmarshal failed, err: %v\n", err)
+		addMsgWithTime(err.Error())
 		return err
 	}
 
@@ -69,6 +105,42 @@ func update(ctx context.Context, baseDir string, progressChan chan<- struct{}) e
 		return fmt.Errorf(msg)
 	}
 
+	err = checkGameVersion(baseDir, serverFileInfo.GameVersion)
+	if err != nil {
+		return err
+	}
+
+	// 确认可以更新后再备份存档，服务器刷新文件列表时不会每次重试都备份
+	if config.Conf.IsBackupSaves {
+		addMsgWithTime("开始备份存档")
+		backupPath, err := backupSaves()
+		if err != nil {
+			log.Warnf("backup saves failed, err: %v\n", err)
+			addMsgWithTime("备份存档失败")
+			return err
+		}
+		if backupPath == "" {
+			addMsgWithTime("没有需要备份的存档")
+		} else {
+			addMsgWithTime(fmt.Sprintf("备份存档完成：%s", backupPath))
+		}
+	}
+
+	if len(serverFileInfo.ModGroups) > 0 {
+		modChoices, err := getModChoices()
+		if err != nil {
+			log.Warnf("get mod choices failed, use default, err: %v\n", err)
+		}
+		serverFileInfo.Files = selectServerFiles(serverFileInfo.Files, serverFileInfo.ModGroups, modChoices)
+	}
+
+	// 离线时始终校验本地文件
+	if !isOffline && isUpToDate(baseDir, serverFileInfo) {
+		log.Debugf("up to date, revision: %d\n", serverFileInfo.Revision)
+		addMsgWithTime("已是最新，无需更新")
+		return nil
+	}
+
 	serverFiles := serverFileInfo.Files
 	fileCount := len(serverFiles)
 	log.Debugf("file count %v\n", fileCount)
@@ -102,7 +174,7 @@ syncFile:
 		default:
 			select {
 			case f := <-syncChan:
-				err := syncFile(f, baseDir, cacheInfo)
+				err := syncFile(f, baseDir, cacheInfo, source)
 				if err != nil {
 					log.Debugf("sync file failed, fileInfo: %+v, err: %s\n", f, err)
 					return err
@@ -122,10 +194,23 @@ syncFile:
 		return err
 	}
 
+	err = saveSyncRecord(baseDir, serverFileInfo.Files, serverFileInfo.Revision, manifest)
+	if err != nil {
+		log.Warnf("save sync record failed, err: %v\n", err)
+	}
+
 	return nil
 }
 
-func syncFile(serverFileInfo *FileInfo, baseDir string, cacheInfo *CacheInfo) error {
+func getServerFileInfo() (*ServerFileInfo, error) {
+	manifest, err := fetchServerManifest()
+	if err != nil {
+		return nil, err
+	}
+	return parseServerManifest(manifest)
+}
+
+func syncFile(serverFileInfo *FileInfo, baseDir string, cacheInfo *CacheInfo, source fileSource) error {
 	var err error
 	log.Debugf("syncing file info %+v\n", serverFileInfo)
 
@@ -186,8 +271,18 @@ func syncFile(serverFileInfo *FileInfo, baseDir string, cacheInfo *CacheInfo) er
 
 				if hashSum == serverFileInfo.Hash {
 					log.Debugf("[SKIP]same file skip , localPath: %s\n", localPath)
+					if isMergeableConfigFile(serverFileInfo.RelativePath) {
+						_, hasBase, err := readConfigBase(baseDir, serverFileInfo.RelativePath)
+						if err == nil && !hasBase {
+							_ = saveConfigBaseFromFile(baseDir, serverFileInfo.RelativePath, localPath)
+						}
+					}
 					return nil
 				}
+
+				if isMergeableConfigFile(serverFileInfo.RelativePath) {
+					return syncConfigFile(serverFileInfo, baseDir, localPath, cacheInfo, source)
+				}
 			} else {
 				log.Debugf("[DELETE]expected a regular file but not, delete it, localPath: %s\n", localPath)
 				err := os.RemoveAll(localPath)
@@ -197,49 +292,25 @@ func syncFile(serverFileInfo *FileInfo, baseDir string, cacheInfo *CacheInfo) er
 			}
 		}
 
-		var srcFile io.ReadCloser
-		isCacheHit := false
-		cachePath := ""
-		if config.Conf.IsUseCache {
-			isCacheHit, cachePath, _ = checkCache(serverFileInfo, cacheInfo)
-		}
-
-		isFinallyUseCache := false
-		if isCacheHit {
-			srcFile, err = os.Open(cachePath)
-			if err != nil {
-				return err
-			}
-			defer srcFile.Close()
-			isFinallyUseCache = true
-
-			syncTypeInfo = "[FROM_CACHE]"
-		}
-		if !isFinallyUseCache {
-			resp, err := http.Get(getFullDownloadUrlByFile(serverFileInfo.RelativePath))
-			if err != nil {
-				return err
-			}
-			defer resp.Body.Close()
-			srcFile = resp.Body
-			defer srcFile.Close()
-
-			syncTypeInfo = "[FROM_SERVER]"
+		if trySyncFileByDelta(serverFileInfo, baseDir, localPath, cacheInfo, source) {
+			log.Debugf("[SYNC][FROM_DELTA]synced info %+v\n", serverFileInfo)
+			return nil
 		}
 
-		localDir := filepath.Dir(localPath)
-		err = os.MkdirAll(localDir, os.ModePerm)
+		srcFile, isFinallyUseCache, err := openSrcFile(serverFileInfo, cacheInfo, source)
 		if err != nil {
 			return err
 		}
-
-		file, err := os.Create(localPath)
-		if err != nil {
-			return err
+		defer srcFile.Close()
+		if isFinallyUseCache {
+			syncTypeInfo = "[FROM_CACHE]"
+		} else if _, ok := source.(*bundleSource); ok {
+			syncTypeInfo = "[FROM_BUNDLE]"
+		} else {
+			syncTypeInfo = "[FROM_SERVER]"
 		}
-		defer file.Close()
 
-		_, err = io.Copy(file, srcFile)
+		err = writeLocalFile(localPath, baseDir, srcFile)
 		if err != nil {
 			return err
 		}
@@ -265,17 +336,18 @@ func syncFile(serverFileInfo *FileInfo, baseDir string, cacheInfo *CacheInfo) er
 			return fmt.Errorf("download file hash check failed, expected: %s, got: %s", serverFileInfo.Hash, hashSum)
 		}
 
-	} else if serverFileInfo.Type == TypeSymlink {
-		resp, err := http.Get(getFullDownloadUrlByFile(serverFileInfo.RelativePath))
-		if err != nil {
-			return err
+		if isMergeableConfigFile(serverFileInfo.RelativePath) {
+			err = saveConfigBaseFromFile(baseDir, serverFileInfo.RelativePath, localPath)
+			if err != nil {
+				log.Warnf("save config base failed, file: %s, err: %v\n", serverFileInfo.RelativePath, err)
+			}
 		}
-		defer resp.Body.Close()
-		serverLinkDestByte, err := io.ReadAll(resp.Body)
+
+	} else if serverFileInfo.Type == TypeSymlink {
+		serverLinkDest, err := source.readLink(serverFileInfo)
 		if err != nil {
 			return err
 		}
-		serverLinkDest := string(serverLinkDestByte)
 
 		if isExist {
 			fi, err := os.Lstat(localPath)
@@ -322,6 +394,115 @@ func syncFile(serverFileInfo *FileInfo, baseDir string, cacheInfo *CacheInfo) er
 	return nil
 }
 
+// writeLocalFile 将src写入localPath，localPath必须在baseDir内
+func writeLocalFile(localPath string, baseDir string, src io.Reader) error {
+	isBelong, err := isBelongDir(localPath, baseDir)
+	if err != nil {
+		return err
+	}
+	if !isBelong {
+		log.Warnf("Not in baseDir, localPath: %s, baseDir: %s\n", localPath, baseDir)
+		return errNotInBaseDir
+	}
+
+	localDir := filepath.Dir(localPath)
+	err = os.MkdirAll(localDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, src)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// openSrcFile 打开需要同步的文件，缓存命中时从缓存读取，否则从source读取，返回是否来自缓存
+func openSrcFile(serverFileInfo *FileInfo, cacheInfo *CacheInfo, source fileSource) (io.ReadCloser, bool, error) {
+	isCacheHit := false
+	cachePath := ""
+	if config.Conf.IsUseCache {
+		isCacheHit, cachePath, _ = checkCache(serverFileInfo, cacheInfo)
+	}
+
+	if isCacheHit {
+		srcFile, err := os.Open(cachePath)
+		if err != nil {
+			return nil, false, err
+		}
+		return srcFile, true, nil
+	}
+
+	srcFile, err := source.openFile(serverFileInfo)
+	if err != nil {
+		return nil, false, err
+	}
+	return srcFile, false, nil
+}
+
+// syncConfigFile 同步本地已修改的配置文件，与上次同步的服务器版本进行三方合并
+func syncConfigFile(serverFileInfo *FileInfo, baseDir string, localPath string, cacheInfo *CacheInfo, source fileSource) error {
+	srcFile, isFromCache, err := openSrcFile(serverFileInfo, cacheInfo, source)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	serverContent, err := io.ReadAll(srcFile)
+	if err != nil {
+		return err
+	}
+	hashSum := md5util.SumString(string(serverContent))
+	if hashSum != serverFileInfo.Hash {
+		return fmt.Errorf("download file hash check failed, expected: %s, got: %s", serverFileInfo.Hash, hashSum)
+	}
+
+	localContent, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	baseContent, hasBase, err := readConfigBase(baseDir, serverFileInfo.RelativePath)
+	if err != nil {
+		log.Warnf("read config base failed, file: %s, err: %v\n", serverFileInfo.RelativePath, err)
+	}
+	if !hasBase {
+		baseContent, hasBase = readConfigBaseFromCache(serverFileInfo, baseDir, cacheInfo)
+	}
+
+	merged, conflicts := mergeCfg(baseContent, hasBase, string(serverContent), string(localContent))
+	if merged != string(localContent) {
+		err = os.WriteFile(localPath, []byte(merged), 0o644)
+		if err != nil {
+			return err
+		}
+	}
+	err = saveConfigBase(baseDir, serverFileInfo.RelativePath, serverContent)
+	if err != nil {
+		log.Warnf("save config base failed, file: %s, err: %v\n", serverFileInfo.RelativePath, err)
+	}
+
+	for _, conflict := range conflicts {
+		serverValue := conflict.ServerValue
+		if serverValue == "" {
+			serverValue = "（已删除）"
+		}
+		addMsgWithTime(fmt.Sprintf("[配置冲突]%s [%s] %s 本地值：%s，服务器值：%s，已使用服务器的值", serverFileInfo.RelativePath, conflict.Section, conflict.Key, conflict.LocalValue, serverValue))
+	}
+
+	syncTypeInfo := "[MERGE_FROM_SERVER]"
+	if isFromCache {
+		syncTypeInfo = "[MERGE_FROM_CACHE]"
+	}
+	log.Debugf("[SYNC]%ssynced info %+v, conflicts: %d\n", syncTypeInfo, serverFileInfo, len(conflicts))
+	return nil
+}
+
 type ClientFileInfo struct {
 	Files []*FileInfo `json:"files"`
 }
@@ -339,6 +520,12 @@ func deleteFiles(serverFileInfo *ServerFileInfo, baseDir string) error {
 		return err
 	}
 
+	importRecord, err := getImportRecord(baseDir)
+	if err != nil {
+		log.Warnf("get import record failed, err: %v\n", err)
+	}
+	importedPaths := getImportedPathMap(importRecord)
+
 	files := clientFileInfo.Files
 	for _, file := range files {
 		if !in(file.RelativePath, serverFileInfo.Files) {
@@ -349,6 +536,11 @@ func deleteFiles(serverFileInfo *ServerFileInfo, baseDir string) error {
 				continue
 			}
 
+			// ignore imported thunderstore package files
+			if importedPaths[normalizeRelativePath(file.RelativePath)] {
+				continue
+			}
+
 			isAllow, err := isAllowDelete(path, baseDir, file.RelativePath)
 			if err != nil {
 				log.Warnf("check delete file failed, err: %v, file: %s\n", err, file.RelativePath)
@@ -504,11 +696,45 @@ const (
 )
 
 func getFullDownloadUrlByFile(relativePath string) string {
-	downloadServers := config.Conf.DownloadServers
+	return getDownloadUrlByFile(getRandomDownloadServer(), relativePath)
+}
+
+var errNoChannelDownloadServer = fmt.Errorf("设置了发布通道或固定版本时不能从OSS下载，请配置SERVER类型的下载服务器")
+
+// getDownloadServers 可用的下载服务器，设置了通道或固定版本时OSS只有最新版本的文件，只使用SERVER类型
+func getDownloadServers() []*config.DownloadServer {
+	if config.Conf.Channel == "" && config.Conf.PinnedRevision <= 0 {
+		return config.Conf.DownloadServers
+	}
+	downloadServers := make([]*config.DownloadServer, 0, len(config.Conf.DownloadServers))
+	for _, downloadServer := range config.Conf.DownloadServers {
+		if downloadServer.Type != DownloadServerTypeOss {
+			downloadServers = append(downloadServers, downloadServer)
+		}
+	}
+	return downloadServers
+}
+
+// checkDownloadServers 开始下载前检查是否有可用的下载服务器
+func checkDownloadServers() error {
+	if len(getDownloadServers()) == 0 {
+		log.Warnf("no download server for channel, channel: %s, pinned revision: %d\n", config.Conf.Channel, config.Conf.PinnedRevision)
+		return errNoChannelDownloadServer
+	}
+	return nil
+}
+
+func getRandomDownloadServer() *config.DownloadServer {
+	downloadServers := getDownloadServers()
+	if len(downloadServers) == 0 {
+		downloadServers = config.Conf.DownloadServers
+	}
 	count := len(downloadServers)
 	randNum := rand.Intn(count)
-	downloadServer := downloadServers[randNum]
+	return downloadServers[randNum]
+}
 
+func getDownloadUrlByFile(downloadServer *config.DownloadServer, relativePath string) string {
 	var u string = ""
 	prefixPath := downloadServer.PrefixPath
 	if downloadServer.Type == DownloadServerTypeOss {
@@ -518,6 +744,7 @@ func getFullDownloadUrlByFile(relativePath string) string {
 	} else {
 		q := url.Values{}
 		q.Set("file", fmt.Sprintf("%s%s", prefixPath, relativePath))
+		addChannelQuery(q)
 		u = fmt.Sprintf("%s%s", getFullDownloadUrl(downloadServer, "/sync"), "?"+q.Encode())
 	}
 	log.Debugf("download from: %s\n", u)
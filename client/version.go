@@ -1,52 +1,62 @@
 package client
 
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/comoyi/valheim-launcher/util/versionutil"
+	"net/url"
+	"runtime"
+)
+
 // set automatically at build time
 var versionText = "1.0.11"
 
-//var versionNo = 101
-//
-//var haveNewVersion = false
-//var lastVersionInfo *Version
-//
-//type Version struct {
-//	Version     string `json:"version"`
-//	VersionNo   int    `json:"version_no"`
-//	Description string `json:"description"`
-//	ChangeLog   string `json:"change_log"`
-//}
-//
-//func CheckNewVersion() {
-//	if haveNewVersion {
-//		return
-//	}
-//
-//	doCheckNewVersion()
-//}
-//
-//func doCheckNewVersion() {
-//	v, err := getLastVersionInfo()
-//	if err != nil {
-//		return
-//	}
-//
-//	lastVersionInfo = v
-//
-//	if versionNo < v.VersionNo {
-//		haveNewVersion = true
-//	}
-//}
-//
-//func getLastVersionInfo() (*Version, error) {
-//	// version check url
-//	url := ""
-//	d, err := httpGet(url)
-//	if err != nil {
-//		return nil, err
-//	}
-//	var v *Version
-//	err = json.Unmarshal([]byte(d), &v)
-//	if err != nil {
-//		return nil, err
-//	}
-//	return v, nil
-//}
+// 启动器发布签名公钥（ed25519，base64编码）
+// set automatically at build time，为空时只提示新版本，不自动更新
+var releasePublicKey = ""
+
+// Version 启动器最新版本信息
+// Url为当前系统对应的启动器文件下载地址，Hash为文件的sha256，Signature为对文件内容的签名
+type Version struct {
+	Version   string `json:"version"`
+	ChangeLog string `json:"change_log"`
+	Url       string `json:"url"`
+	Hash      string `json:"hash"`
+	Signature string `json:"signature"`
+}
+
+// checkNewVersion 有新版本时返回最新版本信息，没有时返回nil
+func checkNewVersion() (*Version, error) {
+	v, err := getLastVersionInfo()
+	if err != nil {
+		return nil, err
+	}
+	if versionutil.Compare(versionText, v.Version) >= 0 {
+		return nil, nil
+	}
+	return v, nil
+}
+
+func getLastVersionInfo() (*Version, error) {
+	q := url.Values{}
+	q.Set("os", runtime.GOOS)
+	q.Set("arch", runtime.GOARCH)
+	d, err := httpGet(fmt.Sprintf("%s?%s", getFullUrl("/launcher/version"), q.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	var v *Version
+	err = json.Unmarshal([]byte(d), &v)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil || v.Version == "" {
+		return nil, fmt.Errorf("version info is empty")
+	}
+	return v, nil
+}
+
+// isSelfUpdatable 配置了发布签名公钥且服务器提供了下载地址时可以自动更新
+func isSelfUpdatable(v *Version) bool {
+	return releasePublicKey != "" && v.Url != "" && v.Hash != "" && v.Signature != ""
+}
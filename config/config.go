@@ -20,7 +20,28 @@ type Config struct {
 	AnnouncementRefreshInterval int64             `toml:"announcement_refresh_interval" mapstructure:"announcement_refresh_interval"`
 	IsUseCache                  bool              `toml:"is_use_cache" mapstructure:"is_use_cache"`
 	CacheDir                    string            `toml:"cache_dir" mapstructure:"cache_dir"`
+	DataDir                     string            `toml:"data_dir" mapstructure:"data_dir"`
 	DownloadServers             []*DownloadServer `toml:"download_servers" mapstructure:"download_servers"`
+	GameServerAddress           string            `toml:"game_server_address" mapstructure:"game_server_address"`
+	ServerStatusRefreshInterval int64             `toml:"server_status_refresh_interval" mapstructure:"server_status_refresh_interval"`
+	IsBackupSaves               bool              `toml:"is_backup_saves" mapstructure:"is_backup_saves"`
+	SaveBackupDir               string            `toml:"save_backup_dir" mapstructure:"save_backup_dir"`
+	SaveBackupKeep              int               `toml:"save_backup_keep" mapstructure:"save_backup_keep"`
+	ManifestPublicKey           string            `toml:"manifest_public_key" mapstructure:"manifest_public_key"`
+	IsLanShare                  bool              `toml:"is_lan_share" mapstructure:"is_lan_share"`
+	LanSharePort                int               `toml:"lan_share_port" mapstructure:"lan_share_port"`
+	LanDiscoveryPort            int               `toml:"lan_discovery_port" mapstructure:"lan_discovery_port"`
+	IsPrefetch                  bool              `toml:"is_prefetch" mapstructure:"is_prefetch"`
+	PrefetchInterval            int64             `toml:"prefetch_interval" mapstructure:"prefetch_interval"`
+	PrefetchRateLimit           int64             `toml:"prefetch_rate_limit" mapstructure:"prefetch_rate_limit"`
+	DownloadRateLimit           int64             `toml:"download_rate_limit" mapstructure:"download_rate_limit"`
+	QuietHours                  string            `toml:"quiet_hours" mapstructure:"quiet_hours"`
+	IsWatchServerEvents         bool              `toml:"is_watch_server_events" mapstructure:"is_watch_server_events"`
+	IsCheckLauncherUpdate       bool              `toml:"is_check_launcher_update" mapstructure:"is_check_launcher_update"`
+	Channel                     string            `toml:"channel" mapstructure:"channel"`
+	PinnedRevision              int64             `toml:"pinned_revision" mapstructure:"pinned_revision"`
+	IsNotify                    bool              `toml:"is_notify" mapstructure:"is_notify"`
+	IsCloseToTray               bool              `toml:"is_close_to_tray" mapstructure:"is_close_to_tray"`
 }
 
 type DownloadServer struct {
@@ -40,6 +61,27 @@ func initDefaultConfig() {
 	viper.SetDefault("announcement_refresh_interval", 60)
 	viper.SetDefault("is_use_cache", true)
 	viper.SetDefault("cache_dir", ".cache")
+	viper.SetDefault("data_dir", ".valheim-launcher-data")
+	viper.SetDefault("game_server_address", "")
+	viper.SetDefault("server_status_refresh_interval", 60)
+	viper.SetDefault("is_backup_saves", false)
+	viper.SetDefault("save_backup_dir", ".valheim-launcher-backup")
+	viper.SetDefault("save_backup_keep", 10)
+	viper.SetDefault("manifest_public_key", "")
+	viper.SetDefault("is_lan_share", false)
+	viper.SetDefault("lan_share_port", 25680)
+	viper.SetDefault("lan_discovery_port", 25681)
+	viper.SetDefault("is_prefetch", false)
+	viper.SetDefault("prefetch_interval", 600)
+	viper.SetDefault("prefetch_rate_limit", 1024)
+	viper.SetDefault("download_rate_limit", 0)
+	viper.SetDefault("quiet_hours", "")
+	viper.SetDefault("is_watch_server_events", true)
+	viper.SetDefault("is_check_launcher_update", true)
+	viper.SetDefault("channel", "")
+	viper.SetDefault("pinned_revision", 0)
+	viper.SetDefault("is_notify", true)
+	viper.SetDefault("is_close_to_tray", false)
 }
 
 func LoadConfig() {
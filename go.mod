@@ -4,6 +4,7 @@ go 1.19
 
 require (
 	fyne.io/fyne/v2 v2.2.3
+	github.com/klauspost/compress v1.15.11
 	github.com/spf13/viper v1.13.0
 )
 
@@ -0,0 +1,27 @@
+package ed25519util
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidPublicKey = fmt.Errorf("invalid ed25519 public key")
+var ErrInvalidSignature = fmt.Errorf("invalid ed25519 signature")
+
+// Verify 校验message的签名，publicKey和signature均为base64编码
+func Verify(publicKey string, message []byte, signature string) error {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return ErrInvalidPublicKey
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return ErrInvalidSignature
+	}
+	if !ed25519.Verify(key, message, sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package deltautil
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+)
+
+// 与rsync相同的弱校验和
+// a = sum(x[i]) mod 2^16
+// b = sum((n - i) * x[i]) mod 2^16，i从0开始，n为块大小
+// weak = a + b * 2^16
+
+const mod = 1 << 16
+
+// Block 目标文件中一个块的签名，Strong为块内容的md5
+type Block struct {
+	Weak   uint32
+	Strong string
+}
+
+func WeakSum(block []byte) uint32 {
+	var a, b uint32
+	n := uint32(len(block))
+	for i, x := range block {
+		a += uint32(x)
+		b += (n - uint32(i)) * uint32(x)
+	}
+	return a%mod | (b%mod)<<16
+}
+
+func StrongSum(block []byte) string {
+	sum := md5.Sum(block)
+	return hex.EncodeToString(sum[:])
+}
+
+// FindBlocks 在r中查找与blocks内容相同的块（每个块大小为blockSize，最后一个不完整的块不查找）
+// 返回块序号到r中偏移量的映射
+func FindBlocks(r io.Reader, blockSize int, blocks []*Block) (map[int]int64, error) {
+	found := make(map[int]int64)
+	if blockSize <= 0 || len(blocks) == 0 {
+		return found, nil
+	}
+
+	weakIndex := make(map[uint32][]int)
+	for i, block := range blocks {
+		weakIndex[block.Weak] = append(weakIndex[block.Weak], i)
+	}
+
+	br := bufio.NewReaderSize(r, 1<<20)
+	window := make([]byte, blockSize)
+	contiguous := make([]byte, blockSize)
+	var offset int64
+	head := 0
+
+	fill := func() (bool, error) {
+		n, err := io.ReadFull(br, window)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		head = 0
+		return n == blockSize, nil
+	}
+	ok, err := fill()
+	if err != nil || !ok {
+		return found, err
+	}
+
+	weak := WeakSum(window)
+	a := weak & 0xffff
+	b := weak >> 16
+	n := uint32(blockSize)
+	for {
+		if indexes, ok := weakIndex[a|b<<16]; ok {
+			copy(contiguous, window[head:])
+			copy(contiguous[blockSize-head:], window[:head])
+			strong := StrongSum(contiguous)
+			isMatched := false
+			for _, i := range indexes {
+				if blocks[i].Strong != strong {
+					continue
+				}
+				isMatched = true
+				if _, exists := found[i]; !exists {
+					found[i] = offset
+				}
+			}
+			if isMatched {
+				offset += int64(blockSize)
+				ok, err := fill()
+				if err != nil || !ok {
+					return found, err
+				}
+				weak = WeakSum(window)
+				a = weak & 0xffff
+				b = weak >> 16
+				continue
+			}
+		}
+
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			return found, nil
+		}
+		if err != nil {
+			return found, err
+		}
+		out := uint32(window[head])
+		window[head] = c
+		head = (head + 1) % blockSize
+		a = (a + mod - out + uint32(c)) % mod
+		b = (b + mod*n - n*out + a) % mod
+		offset++
+	}
+}
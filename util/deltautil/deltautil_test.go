@@ -0,0 +1,166 @@
+package deltautil
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func randomBytes(r *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	r.Read(b)
+	return b
+}
+
+// signature 按blockSize切分target，最后一个块可能不完整
+func signature(target []byte, blockSize int) []*Block {
+	blocks := make([]*Block, 0)
+	for start := 0; start < len(target); start += blockSize {
+		end := start + blockSize
+		if end > len(target) {
+			end = len(target)
+		}
+		blocks = append(blocks, &Block{
+			Weak:   WeakSum(target[start:end]),
+			Strong: StrongSum(target[start:end]),
+		})
+	}
+	return blocks
+}
+
+// checkFound 检查找到的每个块在basis中的内容与target中的块一致，并且expected中的块都找到了
+func checkFound(t *testing.T, basis []byte, target []byte, blockSize int, found map[int]int64, expected []int) {
+	t.Helper()
+	for i, offset := range found {
+		start := i * blockSize
+		end := start + blockSize
+		if end > len(target) {
+			end = len(target)
+		}
+		if offset < 0 || int(offset)+end-start > len(basis) || !bytes.Equal(basis[offset:int(offset)+end-start], target[start:end]) {
+			t.Errorf("block %d found at wrong offset %d", i, offset)
+		}
+	}
+	for _, i := range expected {
+		if _, ok := found[i]; !ok {
+			t.Errorf("block %d not found", i)
+		}
+	}
+}
+
+func TestWeakSumRolling(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	blockSize := 64
+	data := randomBytes(r, blockSize*4)
+	blocks := []*Block{{Weak: WeakSum(data[100 : 100+blockSize]), Strong: StrongSum(data[100 : 100+blockSize])}}
+	found, err := FindBlocks(bytes.NewReader(data), blockSize, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset, ok := found[0]; !ok || offset != 100 {
+		t.Errorf("expected block at offset 100, got: %v", found)
+	}
+}
+
+func TestFindBlocksUnchanged(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	blockSize := 1024
+	target := randomBytes(r, blockSize*8)
+	found, err := FindBlocks(bytes.NewReader(target), blockSize, signature(target, blockSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 8 {
+		t.Errorf("expected 8 blocks, got: %d", len(found))
+	}
+	checkFound(t, target, target, blockSize, found, []int{0, 1, 2, 3, 4, 5, 6, 7})
+}
+
+func TestFindBlocksInsert(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	blockSize := 1024
+	basis := randomBytes(r, blockSize*8)
+	// 在第3个块中间插入数据，之后的块整体后移
+	target := append(append(append([]byte(nil), basis[:blockSize*2+100]...), randomBytes(r, 37)...), basis[blockSize*2+100:]...)
+	found, err := FindBlocks(bytes.NewReader(basis), blockSize, signature(target, blockSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFound(t, basis, target, blockSize, found, []int{0, 1})
+	if _, ok := found[2]; ok {
+		t.Errorf("block 2 should be changed")
+	}
+}
+
+func TestFindBlocksShift(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	blockSize := 1024
+	target := randomBytes(r, blockSize*6)
+	// basis开头多出一些数据，目标的所有块都在非对齐的偏移处
+	basis := append(randomBytes(r, 333), target...)
+	found, err := FindBlocks(bytes.NewReader(basis), blockSize, signature(target, blockSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFound(t, basis, target, blockSize, found, []int{0, 1, 2, 3, 4, 5})
+	if found[0] != 333 {
+		t.Errorf("expected block 0 at offset 333, got: %d", found[0])
+	}
+}
+
+func TestFindBlocksModify(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	blockSize := 1024
+	basis := randomBytes(r, blockSize*6)
+	target := append([]byte(nil), basis...)
+	target[blockSize*3+10] ^= 0xff
+	found, err := FindBlocks(bytes.NewReader(basis), blockSize, signature(target, blockSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFound(t, basis, target, blockSize, found, []int{0, 1, 2, 4, 5})
+	if _, ok := found[3]; ok {
+		t.Errorf("block 3 should be changed")
+	}
+}
+
+func TestFindBlocksPartialLastBlock(t *testing.T) {
+	r := rand.New(rand.NewSource(6))
+	blockSize := 1024
+	target := randomBytes(r, blockSize*4+500)
+	found, err := FindBlocks(bytes.NewReader(target), blockSize, signature(target, blockSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 最后一个不完整的块不查找
+	checkFound(t, target, target, blockSize, found, []int{0, 1, 2, 3})
+	if _, ok := found[4]; ok {
+		t.Errorf("partial last block should not be found")
+	}
+
+	// basis比一个块还短
+	found, err = FindBlocks(bytes.NewReader(target[:100]), blockSize, signature(target, blockSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 0 {
+		t.Errorf("expected no blocks, got: %v", found)
+	}
+}
+
+func TestFindBlocksLargeBlockSize(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	// 块大小超过2^16时滚动计算中的乘法会溢出uint32，结果仍需正确
+	blockSize := 1<<16 + 4099
+	target := randomBytes(r, blockSize*3)
+	basis := append(randomBytes(r, 12345), target...)
+	basis[12345+blockSize+7] ^= 0xff
+	found, err := FindBlocks(bytes.NewReader(basis), blockSize, signature(target, blockSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFound(t, basis, target, blockSize, found, []int{0, 2})
+	if _, ok := found[1]; ok {
+		t.Errorf("block 1 should be changed")
+	}
+}
@@ -0,0 +1,509 @@
+package dotnetutil
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// 读取.NET程序集的元数据（ECMA-335 第II部分），获取程序集名称、版本和BepInPlugin特性
+
+var ErrNotDotNetAssembly = fmt.Errorf("not a .net assembly")
+
+type AssemblyInfo struct {
+	Name    string
+	Version string
+	Plugins []*PluginInfo
+}
+
+// PluginInfo BepInPlugin特性 [BepInPlugin(GUID, Name, Version)]
+type PluginInfo struct {
+	GUID    string
+	Name    string
+	Version string
+}
+
+const (
+	tableModule                 = 0x00
+	tableTypeRef                = 0x01
+	tableTypeDef                = 0x02
+	tableFieldPtr               = 0x03
+	tableField                  = 0x04
+	tableMethodPtr              = 0x05
+	tableMethodDef              = 0x06
+	tableParamPtr               = 0x07
+	tableParam                  = 0x08
+	tableInterfaceImpl          = 0x09
+	tableMemberRef              = 0x0A
+	tableConstant               = 0x0B
+	tableCustomAttribute        = 0x0C
+	tableFieldMarshal           = 0x0D
+	tableDeclSecurity           = 0x0E
+	tableClassLayout            = 0x0F
+	tableFieldLayout            = 0x10
+	tableStandAloneSig          = 0x11
+	tableEventMap               = 0x12
+	tableEventPtr               = 0x13
+	tableEvent                  = 0x14
+	tablePropertyMap            = 0x15
+	tablePropertyPtr            = 0x16
+	tableProperty               = 0x17
+	tableMethodSemantics        = 0x18
+	tableMethodImpl             = 0x19
+	tableModuleRef              = 0x1A
+	tableTypeSpec               = 0x1B
+	tableImplMap                = 0x1C
+	tableFieldRVA               = 0x1D
+	tableEncLog                 = 0x1E
+	tableEncMap                 = 0x1F
+	tableAssembly               = 0x20
+	tableAssemblyRef            = 0x23
+	tableFile                   = 0x26
+	tableExportedType           = 0x27
+	tableManifestResource       = 0x28
+	tableGenericParam           = 0x2A
+	tableMethodSpec             = 0x2B
+	tableGenericParamConstraint = 0x2C
+	tableCount                  = 64
+)
+
+type codedIndex struct {
+	tagBits uint
+	tables  []int
+}
+
+// decode 拆分编码索引，返回对应的表及行号，tag超出范围时返回错误
+func (c *codedIndex) decode(value uint32) (int, uint32, error) {
+	tag := value & (1<<c.tagBits - 1)
+	if int(tag) >= len(c.tables) {
+		return 0, 0, fmt.Errorf("%w: invalid coded index tag %d", ErrNotDotNetAssembly, tag)
+	}
+	return c.tables[tag], value >> c.tagBits, nil
+}
+
+// -1 代表未使用的tag
+var (
+	codedTypeDefOrRef        = &codedIndex{2, []int{tableTypeDef, tableTypeRef, tableTypeSpec}}
+	codedHasConstant         = &codedIndex{2, []int{tableField, tableParam, tableProperty}}
+	codedHasCustomAttribute  = &codedIndex{5, []int{tableMethodDef, tableField, tableTypeRef, tableTypeDef, tableParam, tableInterfaceImpl, tableMemberRef, tableModule, tableDeclSecurity, tableProperty, tableEvent, tableStandAloneSig, tableModuleRef, tableTypeSpec, tableAssembly, tableAssemblyRef, tableFile, tableExportedType, tableManifestResource, tableGenericParam, tableGenericParamConstraint, tableMethodSpec}}
+	codedHasFieldMarshal     = &codedIndex{1, []int{tableField, tableParam}}
+	codedHasDeclSecurity     = &codedIndex{2, []int{tableTypeDef, tableMethodDef, tableAssembly}}
+	codedMemberRefParent     = &codedIndex{3, []int{tableTypeDef, tableTypeRef, tableModuleRef, tableMethodDef, tableTypeSpec}}
+	codedHasSemantics        = &codedIndex{1, []int{tableEvent, tableProperty}}
+	codedMethodDefOrRef      = &codedIndex{1, []int{tableMethodDef, tableMemberRef}}
+	codedMemberForwarded     = &codedIndex{1, []int{tableField, tableMethodDef}}
+	codedCustomAttributeType = &codedIndex{3, []int{-1, -1, tableMethodDef, tableMemberRef, -1}}
+	codedResolutionScope     = &codedIndex{2, []int{tableModule, tableModuleRef, tableAssemblyRef, tableTypeRef}}
+)
+
+type colKind int
+
+const (
+	colU16 colKind = iota
+	colU32
+	colString
+	colGuid
+	colBlob
+	colTable
+	colCoded
+)
+
+type column struct {
+	kind  colKind
+	table int
+	coded *codedIndex
+}
+
+var (
+	u16    = column{kind: colU16}
+	u32    = column{kind: colU32}
+	str    = column{kind: colString}
+	guid   = column{kind: colGuid}
+	blob   = column{kind: colBlob}
+	index  = func(table int) column { return column{kind: colTable, table: table} }
+	coded  = func(c *codedIndex) column { return column{kind: colCoded, coded: c} }
+	schema = map[int][]column{
+		tableModule:          {u16, str, guid, guid, guid},
+		tableTypeRef:         {coded(codedResolutionScope), str, str},
+		tableTypeDef:         {u32, str, str, coded(codedTypeDefOrRef), index(tableField), index(tableMethodDef)},
+		tableFieldPtr:        {index(tableField)},
+		tableField:           {u16, str, blob},
+		tableMethodPtr:       {index(tableMethodDef)},
+		tableMethodDef:       {u32, u16, u16, str, blob, index(tableParam)},
+		tableParamPtr:        {index(tableParam)},
+		tableParam:           {u16, u16, str},
+		tableInterfaceImpl:   {index(tableTypeDef), coded(codedTypeDefOrRef)},
+		tableMemberRef:       {coded(codedMemberRefParent), str, blob},
+		tableConstant:        {u16, coded(codedHasConstant), blob},
+		tableCustomAttribute: {coded(codedHasCustomAttribute), coded(codedCustomAttributeType), blob},
+		tableFieldMarshal:    {coded(codedHasFieldMarshal), blob},
+		tableDeclSecurity:    {u16, coded(codedHasDeclSecurity), blob},
+		tableClassLayout:     {u16, u32, index(tableTypeDef)},
+		tableFieldLayout:     {u32, index(tableField)},
+		tableStandAloneSig:   {blob},
+		tableEventMap:        {index(tableTypeDef), index(tableEvent)},
+		tableEventPtr:        {index(tableEvent)},
+		tableEvent:           {u16, str, coded(codedTypeDefOrRef)},
+		tablePropertyMap:     {index(tableTypeDef), index(tableProperty)},
+		tablePropertyPtr:     {index(tableProperty)},
+		tableProperty:        {u16, str, blob},
+		tableMethodSemantics: {u16, index(tableMethodDef), coded(codedHasSemantics)},
+		tableMethodImpl:      {index(tableTypeDef), coded(codedMethodDefOrRef), coded(codedMethodDefOrRef)},
+		tableModuleRef:       {str},
+		tableTypeSpec:        {blob},
+		tableImplMap:         {u16, coded(codedMemberForwarded), str, index(tableModuleRef)},
+		tableFieldRVA:        {u32, index(tableField)},
+		tableEncLog:          {u32, u32},
+		tableEncMap:          {u32},
+		tableAssembly:        {u32, u16, u16, u16, u16, u32, blob, str, str},
+	}
+)
+
+type metadata struct {
+	strings     []byte
+	blobs       []byte
+	rows        [tableCount]uint32
+	tableOffset [tableCount]int
+	rowSize     [tableCount]int
+	tables      []byte
+	bigString   bool
+	bigGuid     bool
+	bigBlob     bool
+}
+
+// ReadAssemblyInfo 读取程序集信息
+func ReadAssemblyInfo(r io.ReaderAt) (*AssemblyInfo, error) {
+	md, err := readMetadata(r)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &AssemblyInfo{
+		Plugins: make([]*PluginInfo, 0),
+	}
+	if md.rows[tableAssembly] > 0 {
+		row, err := md.row(tableAssembly, 1)
+		if err != nil {
+			return nil, err
+		}
+		info.Name = md.string(row[7])
+		info.Version = fmt.Sprintf("%d.%d.%d.%d", row[1], row[2], row[3], row[4])
+	}
+
+	for i := uint32(1); i <= md.rows[tableCustomAttribute]; i++ {
+		row, err := md.row(tableCustomAttribute, i)
+		if err != nil {
+			return nil, err
+		}
+		typeName, err := md.customAttributeTypeName(row[1])
+		if err != nil || typeName != "BepInPlugin" {
+			continue
+		}
+		args, err := parseStringArgs(md.blob(row[2]), 3)
+		if err != nil {
+			continue
+		}
+		info.Plugins = append(info.Plugins, &PluginInfo{
+			GUID:    args[0],
+			Name:    args[1],
+			Version: args[2],
+		})
+	}
+	return info, nil
+}
+
+func readMetadata(r io.ReaderAt) (*metadata, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, ErrNotDotNetAssembly
+	}
+	defer f.Close()
+
+	var cliDir pe.DataDirectory
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if oh.NumberOfRvaAndSizes <= pe.IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR {
+			return nil, ErrNotDotNetAssembly
+		}
+		cliDir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR]
+	case *pe.OptionalHeader64:
+		if oh.NumberOfRvaAndSizes <= pe.IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR {
+			return nil, ErrNotDotNetAssembly
+		}
+		cliDir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR]
+	default:
+		return nil, ErrNotDotNetAssembly
+	}
+	if cliDir.VirtualAddress == 0 || cliDir.Size < 16 {
+		return nil, ErrNotDotNetAssembly
+	}
+
+	cliHeader, err := readRVA(f, cliDir.VirtualAddress, 16)
+	if err != nil {
+		return nil, err
+	}
+	metadataRVA := binary.LittleEndian.Uint32(cliHeader[8:12])
+	metadataSize := binary.LittleEndian.Uint32(cliHeader[12:16])
+	root, err := readRVA(f, metadataRVA, metadataSize)
+	if err != nil {
+		return nil, err
+	}
+	return parseMetadataRoot(root)
+}
+
+func readRVA(f *pe.File, rva uint32, size uint32) ([]byte, error) {
+	for _, section := range f.Sections {
+		// 使用uint64比较，避免rva+size溢出
+		if rva >= section.VirtualAddress && uint64(rva)+uint64(size) <= uint64(section.VirtualAddress)+uint64(section.Size) {
+			buf := make([]byte, size)
+			_, err := section.ReadAt(buf, int64(rva-section.VirtualAddress))
+			if err != nil {
+				return nil, err
+			}
+			return buf, nil
+		}
+	}
+	return nil, fmt.Errorf("rva 0x%x not found in sections", rva)
+}
+
+func parseMetadataRoot(root []byte) (*metadata, error) {
+	if len(root) < 16 || binary.LittleEndian.Uint32(root[0:4]) != 0x424A5342 {
+		return nil, ErrNotDotNetAssembly
+	}
+	versionLength := int(binary.LittleEndian.Uint32(root[12:16]))
+	pos := 16 + versionLength
+	if pos+4 > len(root) {
+		return nil, ErrNotDotNetAssembly
+	}
+	streamCount := int(binary.LittleEndian.Uint16(root[pos+2 : pos+4]))
+	pos += 4
+
+	md := &metadata{}
+	for i := 0; i < streamCount; i++ {
+		if pos+8 > len(root) {
+			return nil, ErrNotDotNetAssembly
+		}
+		offset := int(binary.LittleEndian.Uint32(root[pos : pos+4]))
+		size := int(binary.LittleEndian.Uint32(root[pos+4 : pos+8]))
+		pos += 8
+		end := bytes.IndexByte(root[pos:], 0)
+		if end < 0 {
+			return nil, ErrNotDotNetAssembly
+		}
+		name := string(root[pos : pos+end])
+		pos += (end + 4) &^ 3
+		if offset+size > len(root) {
+			return nil, ErrNotDotNetAssembly
+		}
+		data := root[offset : offset+size]
+		switch name {
+		case "#~":
+			md.tables = data
+		case "#Strings":
+			md.strings = data
+		case "#Blob":
+			md.blobs = data
+		}
+	}
+	if md.tables == nil {
+		return nil, ErrNotDotNetAssembly
+	}
+	return md, md.parseTables()
+}
+
+func (md *metadata) parseTables() error {
+	if len(md.tables) < 24 {
+		return ErrNotDotNetAssembly
+	}
+	heapSizes := md.tables[6]
+	md.bigString = heapSizes&0x01 != 0
+	md.bigGuid = heapSizes&0x02 != 0
+	md.bigBlob = heapSizes&0x04 != 0
+	valid := binary.LittleEndian.Uint64(md.tables[8:16])
+
+	pos := 24
+	for i := 0; i < tableCount; i++ {
+		if valid&(1<<uint(i)) == 0 {
+			continue
+		}
+		if pos+4 > len(md.tables) {
+			return ErrNotDotNetAssembly
+		}
+		md.rows[i] = binary.LittleEndian.Uint32(md.tables[pos : pos+4])
+		pos += 4
+	}
+
+	for i := 0; i <= tableAssembly; i++ {
+		size := 0
+		for _, col := range schema[i] {
+			size += md.columnSize(col)
+		}
+		md.rowSize[i] = size
+		md.tableOffset[i] = pos
+		pos += size * int(md.rows[i])
+	}
+	if pos > len(md.tables) {
+		return ErrNotDotNetAssembly
+	}
+	return nil
+}
+
+func (md *metadata) columnSize(col column) int {
+	switch col.kind {
+	case colU16:
+		return 2
+	case colU32:
+		return 4
+	case colString:
+		return heapIndexSize(md.bigString)
+	case colGuid:
+		return heapIndexSize(md.bigGuid)
+	case colBlob:
+		return heapIndexSize(md.bigBlob)
+	case colTable:
+		if md.rows[col.table] < 1<<16 {
+			return 2
+		}
+		return 4
+	case colCoded:
+		var maxRows uint32
+		for _, table := range col.coded.tables {
+			if table >= 0 && md.rows[table] > maxRows {
+				maxRows = md.rows[table]
+			}
+		}
+		if maxRows < 1<<(16-col.coded.tagBits) {
+			return 2
+		}
+		return 4
+	}
+	return 0
+}
+
+func heapIndexSize(isBig bool) int {
+	if isBig {
+		return 4
+	}
+	return 2
+}
+
+// row 读取表的第i行，i从1开始
+func (md *metadata) row(table int, i uint32) ([]uint32, error) {
+	if i == 0 || i > md.rows[table] {
+		return nil, fmt.Errorf("row %d out of range in table 0x%x", i, table)
+	}
+	pos := md.tableOffset[table] + md.rowSize[table]*int(i-1)
+	values := make([]uint32, 0, len(schema[table]))
+	for _, col := range schema[table] {
+		size := md.columnSize(col)
+		if pos+size > len(md.tables) {
+			return nil, ErrNotDotNetAssembly
+		}
+		if size == 2 {
+			values = append(values, uint32(binary.LittleEndian.Uint16(md.tables[pos:pos+2])))
+		} else {
+			values = append(values, binary.LittleEndian.Uint32(md.tables[pos:pos+4]))
+		}
+		pos += size
+	}
+	return values, nil
+}
+
+func (md *metadata) string(offset uint32) string {
+	if int(offset) >= len(md.strings) {
+		return ""
+	}
+	s := md.strings[offset:]
+	end := bytes.IndexByte(s, 0)
+	if end < 0 {
+		return string(s)
+	}
+	return string(s[:end])
+}
+
+func (md *metadata) blob(offset uint32) []byte {
+	if int(offset) >= len(md.blobs) {
+		return nil
+	}
+	length, n := decodeCompressedUint(md.blobs[offset:])
+	start := int(offset) + n
+	if n == 0 || start+int(length) > len(md.blobs) {
+		return nil
+	}
+	return md.blobs[start : start+int(length)]
+}
+
+// customAttributeTypeName 获取特性构造函数所属类型的名称，只处理引用外部程序集的特性
+func (md *metadata) customAttributeTypeName(value uint32) (string, error) {
+	table, index, err := codedCustomAttributeType.decode(value)
+	if err != nil {
+		return "", err
+	}
+	if table != tableMemberRef {
+		return "", nil
+	}
+	memberRef, err := md.row(tableMemberRef, index)
+	if err != nil {
+		return "", err
+	}
+	table, index, err = codedMemberRefParent.decode(memberRef[0])
+	if err != nil {
+		return "", err
+	}
+	if table != tableTypeRef {
+		return "", nil
+	}
+	typeRef, err := md.row(tableTypeRef, index)
+	if err != nil {
+		return "", err
+	}
+	return md.string(typeRef[1]), nil
+}
+
+func decodeCompressedUint(b []byte) (uint32, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	if b[0]&0x80 == 0 {
+		return uint32(b[0]), 1
+	}
+	if b[0]&0xC0 == 0x80 {
+		if len(b) < 2 {
+			return 0, 0
+		}
+		return uint32(b[0]&0x3F)<<8 | uint32(b[1]), 2
+	}
+	if len(b) < 4 {
+		return 0, 0
+	}
+	return uint32(b[0]&0x1F)<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3]), 4
+}
+
+// parseStringArgs 解析特性的固定参数，要求前count个参数均为字符串
+func parseStringArgs(value []byte, count int) ([]string, error) {
+	if len(value) < 2 || value[0] != 0x01 || value[1] != 0x00 {
+		return nil, fmt.Errorf("invalid custom attribute prolog")
+	}
+	pos := 2
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		if pos >= len(value) {
+			return nil, fmt.Errorf("custom attribute value truncated")
+		}
+		if value[pos] == 0xFF {
+			args = append(args, "")
+			pos++
+			continue
+		}
+		length, n := decodeCompressedUint(value[pos:])
+		pos += n
+		if n == 0 || pos+int(length) > len(value) {
+			return nil, fmt.Errorf("custom attribute value truncated")
+		}
+		args = append(args, string(value[pos:pos+int(length)]))
+		pos += int(length)
+	}
+	return args, nil
+}
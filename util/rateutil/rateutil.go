@@ -0,0 +1,109 @@
+package rateutil
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// 每次读取的最大字节数，避免一次读取过多导致等待时间过长
+const maxReadSize = 32 * 1024
+
+// Limiter 令牌桶限速器，可被多个下载同时使用，限速可随时修改
+type Limiter struct {
+	mutex  sync.Mutex
+	limit  int64 // 每秒字节数，小于等于0代表不限速
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter(limit int64) *Limiter {
+	return &Limiter{
+		limit:  limit,
+		tokens: float64(limit),
+		last:   time.Now(),
+	}
+}
+
+func (l *Limiter) Limit() int64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.limit
+}
+
+func (l *Limiter) SetLimit(limit int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.limit = limit
+	if l.tokens > float64(limit) {
+		l.tokens = float64(limit)
+	}
+	l.last = time.Now()
+}
+
+// WaitN 预留n个字节的令牌，令牌不足时等待
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	l.mutex.Lock()
+	if l.limit <= 0 {
+		l.mutex.Unlock()
+		return nil
+	}
+	now := time.Now()
+	limit := float64(l.limit)
+	l.tokens += now.Sub(l.last).Seconds() * limit
+	if l.tokens > limit {
+		l.tokens = limit
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / limit * float64(time.Second))
+	}
+	l.mutex.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type reader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *Limiter
+}
+
+// NewReader 返回按limiter限速的Reader，limiter为nil时不限速
+func NewReader(ctx context.Context, r io.Reader, limiter *Limiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return &reader{
+		ctx:     ctx,
+		r:       r,
+		limiter: limiter,
+	}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > maxReadSize {
+		p = p[:maxReadSize]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		waitErr := r.limiter.WaitN(r.ctx, n)
+		if waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,18 @@
+package sizeutil
+
+import "fmt"
+
+// FormatSize 格式化文件大小 例：1536 -> 1.50 KB
+func FormatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	s := float64(size)
+	i := 0
+	for s >= 1024 && i < len(units)-1 {
+		s /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d %s", size, units[i])
+	}
+	return fmt.Sprintf("%.2f %s", s, units[i])
+}
@@ -2,6 +2,7 @@ package timeutil
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -61,3 +62,26 @@ func FormatDuration(second int64) string {
 	str = fmt.Sprintf("%s%d秒", str, s)
 	return str
 }
+
+// IsInDailyRange 判断t是否在每天的时间段内 例：23:00-07:00 表示23点到次日7点
+func IsInDailyRange(t time.Time, dailyRange string) (bool, error) {
+	parts := strings.Split(strings.TrimSpace(dailyRange), "-")
+	if len(parts) != 2 {
+		return false, fmt.Errorf("invalid daily range: %s", dailyRange)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(parts[0]))
+	if err != nil {
+		return false, err
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(parts[1]))
+	if err != nil {
+		return false, err
+	}
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+	minute := t.Hour()*60 + t.Minute()
+	if startMinute <= endMinute {
+		return minute >= startMinute && minute < endMinute, nil
+	}
+	return minute >= startMinute || minute < endMinute, nil
+}
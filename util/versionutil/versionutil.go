@@ -0,0 +1,57 @@
+package versionutil
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Compare 比较两个以点分隔的版本号 例：1.0.9 < 1.0.11 返回 -1
+// 非数字部分按字符串比较，缺少的部分视为0
+func Compare(a, b string) int {
+	as := split(a)
+	bs := split(b)
+	n := len(as)
+	if len(bs) > n {
+		n = len(bs)
+	}
+	for i := 0; i < n; i++ {
+		x := "0"
+		if i < len(as) {
+			x = as[i]
+		}
+		y := "0"
+		if i < len(bs) {
+			y = bs[i]
+		}
+		r := compareSegment(x, y)
+		if r != 0 {
+			return r
+		}
+	}
+	return 0
+}
+
+func split(version string) []string {
+	version = strings.TrimSpace(version)
+	version = strings.TrimPrefix(version, "v")
+	version = strings.TrimPrefix(version, "V")
+	if version == "" {
+		return nil
+	}
+	return strings.Split(version, ".")
+}
+
+func compareSegment(x, y string) int {
+	xn, xErr := strconv.ParseInt(x, 10, 64)
+	yn, yErr := strconv.ParseInt(y, 10, 64)
+	if xErr == nil && yErr == nil {
+		if xn < yn {
+			return -1
+		}
+		if xn > yn {
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(x, y)
+}
@@ -0,0 +1,146 @@
+package ziputil
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrIllegalPath = fmt.Errorf("illegal path in zip file")
+
+// Compress 将baseDir下的relativePaths（文件或文件夹）压缩到dst，zip内的路径为相对baseDir的路径
+func Compress(dst string, baseDir string, relativePaths []string) error {
+	file, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+	for _, relativePath := range relativePaths {
+		root := filepath.Join(baseDir, relativePath)
+		err = filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name, err := filepath.Rel(baseDir, path)
+			if err != nil {
+				return err
+			}
+			return AddFile(zw, path, name, info)
+		})
+		if err != nil {
+			zw.Close()
+			return err
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// AddFile 将path对应的文件或文件夹以name添加到zip，其他类型的文件会被忽略
+func AddFile(zw *zip.Writer, path string, name string, info fs.FileInfo) error {
+	name = filepath.ToSlash(name)
+	if info.IsDir() {
+		_, err := zw.Create(name + "/")
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Extract 解压src到dstDir，包含dstDir之外路径的zip会被拒绝
+func Extract(src string, dstDir string) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		path, err := SafeJoin(dstDir, f.Name)
+		if err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			err = os.MkdirAll(path, os.ModePerm)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err = extractFile(f, path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractFile(f *zip.File, path string) error {
+	if !f.Mode().IsRegular() {
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(file, rc)
+	return err
+}
+
+// SafeJoin 拼接zip内的路径，防止zip slip
+func SafeJoin(dstDir string, name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || strings.HasPrefix(name, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("%w: %s", ErrIllegalPath, name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("%w: %s", ErrIllegalPath, name)
+		}
+	}
+	dstDir = filepath.Clean(dstDir)
+	path := filepath.Join(dstDir, filepath.FromSlash(name))
+	if path != dstDir && !strings.HasPrefix(path, dstDir+string(os.PathSeparator)) {
+		return "", fmt.Errorf("%w: %s", ErrIllegalPath, name)
+	}
+	return path, nil
+}